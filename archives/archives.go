@@ -0,0 +1,188 @@
+package archives
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nwaples/rardecode/v2"
+)
+
+// rarPart matches the volumes of a multi-part RAR set named like movie.part01.rar
+var rarPart = regexp.MustCompile(`(?i)\.part(\d+)\.rar$`)
+
+// Result sums up what was extracted from an archive
+type Result struct {
+	Archive string
+	Files   int
+	Bytes   int64
+	Paths   []string
+}
+
+// Find returns the archives among the files of a torrent, one per multi-part set: the first
+// volume, from which the others are read. Split ZIP sets are not supported
+func Find(files []string) []string {
+	var archives []string
+	for _, file := range files {
+		lower := strings.ToLower(file)
+		switch {
+		case strings.HasSuffix(lower, ".zip"):
+			archives = append(archives, file)
+		case strings.HasSuffix(lower, ".rar"):
+			if match := rarPart.FindStringSubmatch(file); match != nil {
+				if part, err := strconv.Atoi(match[1]); err != nil || part != 1 {
+					continue
+				}
+			}
+			archives = append(archives, file)
+		}
+	}
+	return archives
+}
+
+// Extract unpacks a ZIP or RAR archive into a directory, leaving the archive in place. Every
+// file is checked against the checksum and size stored in the archive, and a file that fails
+// the check is deleted
+func Extract(archive, destination string) (Result, error) {
+	result := Result{Archive: archive}
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return result, err
+	}
+
+	var err error
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		err = extractZip(archive, destination, &result)
+	} else {
+		err = extractRar(archive, destination, &result)
+	}
+	return result, err
+}
+
+// extractZip unpacks a ZIP archive, archive/zip verifies the CRC-32 of every file as it is read
+func extractZip(archive, destination string, result *Result) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if strings.HasSuffix(file.Name, "/") {
+			if err := makeDir(destination, file.Name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file.Name, err)
+		}
+		path, n, err := writeFile(destination, file.Name, content, int64(file.UncompressedSize64), file.Mode())
+		content.Close()
+		if err != nil {
+			return err
+		}
+		result.Files++
+		result.Bytes += n
+		result.Paths = append(result.Paths, path)
+	}
+	return nil
+}
+
+// extractRar unpacks a RAR archive and the volumes following it, rardecode verifies the
+// checksum of every file as it is read
+func extractRar(archive, destination string, result *Result) error {
+	reader, err := rardecode.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Encrypted {
+			return fmt.Errorf("%s is password protected", header.Name)
+		}
+		if header.IsDir {
+			if err := makeDir(destination, header.Name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		size := header.UnPackedSize
+		if header.UnKnownSize {
+			size = -1
+		}
+		path, n, err := writeFile(destination, header.Name, reader, size, header.Mode())
+		if err != nil {
+			return err
+		}
+		result.Files++
+		result.Bytes += n
+		result.Paths = append(result.Paths, path)
+	}
+}
+
+// target returns where a file of an archive goes, refusing names that escape the destination
+func target(destination, name string) (string, error) {
+	destination = filepath.Clean(destination)
+	path := filepath.Join(destination, filepath.FromSlash(name))
+	if path != destination && !strings.HasPrefix(path, destination+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s points outside of the destination", name)
+	}
+	return path, nil
+}
+
+// makeDir creates a directory of an archive
+func makeDir(destination, name string) error {
+	path, err := target(destination, name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+// writeFile copies a file out of an archive and checks its size when known (size >= 0), it
+// returns where the file was written and its size
+func writeFile(destination, name string, content io.Reader, size int64, mode os.FileMode) (string, int64, error) {
+	path, err := target(destination, name)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return "", 0, err
+	}
+
+	n, err := io.Copy(out, content)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && n != size {
+		err = errors.New("size mismatch")
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, fmt.Errorf("%s: %v", name, err)
+	}
+	return path, n, nil
+}
@@ -0,0 +1,172 @@
+package archives
+
+import (
+	"archive/zip"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// zipEntry is a file written raw into a test ZIP, so its header can lie about its size
+type zipEntry struct {
+	name string
+	data string
+	size uint64
+}
+
+// writeZip creates a ZIP archive holding the entries, stored without compression
+func writeZip(t *testing.T, path string, entries []zipEntry) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:               entry.name,
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE([]byte(entry.data)),
+			CompressedSize64:   uint64(len(entry.data)),
+			UncompressedSize64: entry.size,
+		}
+		w, err := writer.CreateRaw(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	files := []string{
+		"/d/movie.part01.rar", "/d/movie.part02.rar", "/d/show.rar", "/d/show.r00",
+		"/d/extras.ZIP", "/d/movie.mkv", "/d/other.part2.rar",
+	}
+	want := []string{"/d/movie.part01.rar", "/d/show.rar", "/d/extras.ZIP"}
+	if got := Find(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("Find = %v, want %v", got, want)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	destination := filepath.Join(string(filepath.Separator), "extracted")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"file.txt", filepath.Join(destination, "file.txt")},
+		{"sub/dir/file.txt", filepath.Join(destination, "sub", "dir", "file.txt")},
+		{"sub/../file.txt", filepath.Join(destination, "file.txt")},
+		{"/abs/file.txt", filepath.Join(destination, "abs", "file.txt")},
+		{"../file.txt", ""},
+		{"sub/../../file.txt", ""},
+		{"../extracted-sibling/file.txt", ""},
+	}
+	for _, test := range tests {
+		got, err := target(destination, test.name)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("target(%q) = %q, want it refused", test.name, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("target(%q) = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "files.zip")
+	writeZip(t, archive, []zipEntry{
+		{name: "sub/", size: 0},
+		{name: "sub/a.txt", data: "hello", size: 5},
+		{name: "b.txt", data: "world!", size: 6},
+	})
+
+	destination := filepath.Join(dir, "out")
+	result, err := Extract(archive, destination)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if result.Files != 2 || result.Bytes != 11 {
+		t.Errorf("got %d files and %d bytes, want 2 and 11", result.Files, result.Bytes)
+	}
+	content, err := os.ReadFile(filepath.Join(destination, "sub", "a.txt"))
+	if err != nil || string(content) != "hello" {
+		t.Errorf("got %q, %v, want the extracted content", content, err)
+	}
+}
+
+func TestExtractZipSlip(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.zip")
+	writeZip(t, archive, []zipEntry{{name: "../evil.txt", data: "pwned", size: 5}})
+
+	destination := filepath.Join(dir, "out")
+	_, err := Extract(archive, destination)
+	if err == nil || !strings.Contains(err.Error(), "outside of the destination") {
+		t.Errorf("got error %v, want the entry refused", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the entry was written outside of the destination: %v", err)
+	}
+}
+
+func TestExtractZipOversized(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "oversized.zip")
+	// The header claims fewer bytes than the entry holds
+	writeZip(t, archive, []zipEntry{{name: "big.txt", data: "much more than announced", size: 4}})
+
+	destination := filepath.Join(dir, "out")
+	if _, err := Extract(archive, destination); err == nil {
+		t.Error("expected an error for an entry larger than its header says")
+	}
+	if _, err := os.Stat(filepath.Join(destination, "big.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the oversized entry was kept: %v", err)
+	}
+}
+
+func TestWriteFileSizeMismatch(t *testing.T) {
+	destination := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		size    int64
+		wantErr bool
+	}{
+		{"exact.txt", "12345", 5, false},
+		{"unknown.txt", "12345", -1, false},
+		{"longer.txt", "1234567890", 5, true},
+		{"shorter.txt", "123", 5, true},
+	}
+	for _, test := range tests {
+		path, n, err := writeFile(destination, test.name, strings.NewReader(test.content), test.size, 0644)
+		if test.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "size mismatch") {
+				t.Errorf("%s: got error %v, want a size mismatch", test.name, err)
+			}
+			if _, statErr := os.Stat(filepath.Join(destination, test.name)); !errors.Is(statErr, os.ErrNotExist) {
+				t.Errorf("%s: the file was kept after the mismatch", test.name)
+			}
+			continue
+		}
+		if err != nil || n != int64(len(test.content)) || path != filepath.Join(destination, test.name) {
+			t.Errorf("%s: writeFile = %q, %d, %v", test.name, path, n, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Roles that can be granted to users and chats in config.yaml
+const (
+	roleAdmin  = "admin"
+	roleFamily = "family"
+	roleKid    = "kid"
+)
+
+// Role sets used by the command handlers
+var (
+	adminOnly = []string{roleAdmin}
+	adults    = []string{roleAdmin, roleFamily}
+	everyone  = []string{roleAdmin, roleFamily, roleKid}
+)
+
+// authorizer decides which roles the sender of a message has
+type authorizer struct {
+	users        map[int]string
+	chats        map[int64]string
+	adminChatID  int64
+	reportDenied bool
+}
+
+// newAuthorizer builds the allow-lists from the telegram configuration
+func newAuthorizer(cfg config.Telegram) *authorizer {
+	a := &authorizer{
+		users:        make(map[int]string),
+		chats:        make(map[int64]string),
+		reportDenied: cfg.ReportDenied,
+	}
+
+	for _, user := range cfg.Users {
+		a.users[user.ID] = user.Role
+	}
+	for _, chat := range cfg.Chats {
+		a.chats[chat.ID] = chat.Role
+	}
+
+	if cfg.ChatID != "" {
+		chatID, err := strconv.ParseInt(cfg.ChatID, 10, 64)
+		if err != nil {
+			log.Printf("Invalid telegram chatID %q, denied attempts won't be reported: %v", cfg.ChatID, err)
+		}
+		a.adminChatID = chatID
+	}
+
+	// Without allow-lists only the admin chat is trusted, never everybody
+	if len(a.users) == 0 && len(a.chats) == 0 {
+		if a.adminChatID != 0 {
+			a.chats[a.adminChatID] = roleAdmin
+			log.Printf("WARNING: no telegram users or chats configured, only chat %d can use the bot, as admin. "+
+				"List the allowed users and chats under telegram.users and telegram.chats", a.adminChatID)
+		} else {
+			log.Println("WARNING: no telegram users, chats or chatID configured, nobody can use the bot. " +
+				"List the allowed users and chats under telegram.users and telegram.chats")
+		}
+	}
+
+	return a
+}
+
+// sender returns the chat and the user an update comes from
+func sender(update tgbotapi.Update) (int64, *tgbotapi.User) {
+	if update.CallbackQuery != nil {
+		var chatID int64
+		if update.CallbackQuery.Message != nil {
+			chatID = update.CallbackQuery.Message.Chat.ID
+		}
+		return chatID, update.CallbackQuery.From
+	}
+	if update.Message != nil {
+		return update.Message.Chat.ID, update.Message.From
+	}
+	return 0, nil
+}
+
+// role returns the role of the sender of the update, user roles take precedence over chat roles
+func (a *authorizer) role(update tgbotapi.Update) (string, bool) {
+	chatID, from := sender(update)
+	if from != nil {
+		if role, ok := a.users[from.ID]; ok {
+			return role, true
+		}
+	}
+
+	role, ok := a.chats[chatID]
+	return role, ok
+}
+
+// allowed checks the sender of the update has one of the given roles
+func (a *authorizer) allowed(update tgbotapi.Update, roles []string) bool {
+	role, ok := a.role(update)
+	if !ok {
+		return false
+	}
+
+	for _, allowed := range roles {
+		if role == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize checks the sender of the update may perform the action, denied attempts are logged,
+// answered and optionally reported to the admin chat
+func (b *Bot) authorize(update tgbotapi.Update, action string, roles []string) bool {
+	if b.auth.allowed(update, roles) {
+		return true
+	}
+
+	chatID, from := sender(update)
+	who := "unknown user"
+	if from != nil {
+		who = fmt.Sprintf("%s (%d)", from.String(), from.ID)
+	}
+	log.Printf("Denied %s to %s in chat %d", action, who, chatID)
+
+	if update.CallbackQuery != nil {
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, "Sorry, you are not allowed to do that."))
+	} else {
+		msg := tgbotapi.NewMessage(chatID, "Sorry, you are not allowed to do that.")
+		b.BotAPI.Send(msg)
+	}
+
+	if b.auth.reportDenied && b.auth.adminChatID != 0 && b.auth.adminChatID != chatID {
+		report := tgbotapi.NewMessage(b.auth.adminChatID,
+			fmt.Sprintf("Denied %s to %s in chat %d", action, who, chatID))
+		if _, err := b.BotAPI.Send(report); err != nil {
+			log.Println("Error reporting denied attempt:", err)
+		}
+	}
+
+	return false
+}
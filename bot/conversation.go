@@ -0,0 +1,249 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// conversationTimeout is how long a conversation waits for the next user input
+const conversationTimeout = 5 * time.Minute
+
+var (
+	errConversationCancelled = errors.New("conversation cancelled")
+	errConversationTimeout   = errors.New("conversation timed out")
+)
+
+// conversationKey identifies a conversation by chat and user, so two people in the
+// same group chat can each have their own
+type conversationKey struct {
+	ChatID int64
+	UserID int
+}
+
+// conversation holds the state of a multi-step exchange with a single user
+type conversation struct {
+	key     conversationKey
+	step    string
+	updates chan tgbotapi.Update
+	cancel  chan struct{}
+}
+
+// conversationManager routes incoming updates to the conversation waiting for them
+type conversationManager struct {
+	mu            sync.Mutex
+	conversations map[conversationKey]*conversation
+	timeout       time.Duration
+}
+
+// newConversationManager creates an empty conversation manager
+func newConversationManager(timeout time.Duration) *conversationManager {
+	return &conversationManager{
+		conversations: make(map[conversationKey]*conversation),
+		timeout:       timeout,
+	}
+}
+
+// keyForCallback builds the conversation key of the user pressing an inline button
+func keyForCallback(query *tgbotapi.CallbackQuery) conversationKey {
+	key := conversationKey{UserID: query.From.ID}
+	if query.Message != nil {
+		key.ChatID = query.Message.Chat.ID
+	}
+	return key
+}
+
+// conversationButton builds an inline button answering the pending question of a conversation
+func conversationButton(text, value string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, "conv:"+value)
+}
+
+// keyForMessage builds the conversation key of the sender of a message
+func keyForMessage(message *tgbotapi.Message) conversationKey {
+	key := conversationKey{ChatID: message.Chat.ID}
+	if message.From != nil {
+		key.UserID = message.From.ID
+	}
+	return key
+}
+
+// begin registers a new conversation, it returns false if one is already active for the key
+func (m *conversationManager) begin(key conversationKey) (*conversation, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.conversations[key]; ok {
+		return nil, false
+	}
+
+	c := &conversation{
+		key:     key,
+		updates: make(chan tgbotapi.Update, 10),
+		cancel:  make(chan struct{}),
+	}
+	m.conversations[key] = c
+	return c, true
+}
+
+// finish removes the conversation from the manager
+func (m *conversationManager) finish(c *conversation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conversations[c.key] == c {
+		delete(m.conversations, c.key)
+	}
+}
+
+// dispatch hands the update to the active conversation for the key, if any
+func (m *conversationManager) dispatch(key conversationKey, update tgbotapi.Update) bool {
+	m.mu.Lock()
+	c, ok := m.conversations[key]
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	// The step belongs to the handler goroutine, so only the key is logged here
+	select {
+	case c.updates <- update:
+	default:
+		log.Printf("Conversation %v is not keeping up, dropping update", key)
+	}
+	return true
+}
+
+// cancel aborts the active conversation for the key, it returns false if there was none
+func (m *conversationManager) cancel(key conversationKey) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.conversations[key]
+	if !ok {
+		return false
+	}
+
+	delete(m.conversations, key)
+	close(c.cancel)
+	return true
+}
+
+// wait blocks until the user sends the next update, cancels the conversation or the timeout expires
+func (c *conversation) wait(step string, timeout time.Duration) (tgbotapi.Update, error) {
+	c.step = step
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case update := <-c.updates:
+		return update, nil
+	case <-c.cancel:
+		return tgbotapi.Update{}, errConversationCancelled
+	case <-timer.C:
+		return tgbotapi.Update{}, errConversationTimeout
+	}
+}
+
+// converse starts a conversation for the sender of the message and runs the handler in its own
+// goroutine, so Start can keep dispatching updates from other chats while it waits for input
+func (b *Bot) converse(message *tgbotapi.Message, handler func(c *conversation) error) {
+	b.converseWith(keyForMessage(message), handler)
+}
+
+// converseWith starts a conversation for the given key, which lets an inline button start one
+// with the user who pressed it
+func (b *Bot) converseWith(key conversationKey, handler func(c *conversation) error) {
+	c, ok := b.conversations.begin(key)
+	if !ok {
+		msg := tgbotapi.NewMessage(key.ChatID, "Finish the current conversation first or send /cancel to abort it.")
+		b.BotAPI.Send(msg)
+		return
+	}
+
+	go func() {
+		defer b.conversations.finish(c)
+
+		err := handler(c)
+		switch err {
+		case nil:
+		case errConversationCancelled:
+			// The user was already told by HandleCancel
+		case errConversationTimeout:
+			log.Printf("Conversation %v timed out at step %q", c.key, c.step)
+			msg := tgbotapi.NewMessage(c.key.ChatID, "No answer received, the operation has been cancelled.")
+			b.BotAPI.Send(msg)
+		default:
+			log.Printf("Conversation %v failed at step %q: %v", c.key, c.step, err)
+			msg := tgbotapi.NewMessage(c.key.ChatID, fmt.Sprintf("Something went wrong: %v", err))
+			b.BotAPI.Send(msg)
+		}
+	}()
+}
+
+// ask sends a prompt to the user, with an optional inline keyboard, and waits for the answer,
+// which can be a message or a press on one of the prompt's buttons
+func (b *Bot) ask(c *conversation, step, prompt string, keyboard *tgbotapi.InlineKeyboardMarkup) (tgbotapi.Update, error) {
+	msg := tgbotapi.NewMessage(c.key.ChatID, prompt)
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	sent, err := b.BotAPI.Send(msg)
+	if err != nil {
+		log.Printf("Error sending prompt for step %q: %v", step, err)
+	}
+
+	for {
+		update, err := c.wait(step, b.conversations.timeout)
+		if err != nil {
+			return update, err
+		}
+
+		if update.CallbackQuery != nil {
+			b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+			// Buttons of earlier prompts are stale
+			if update.CallbackQuery.Message == nil || update.CallbackQuery.Message.MessageID != sent.MessageID {
+				continue
+			}
+			return update, nil
+		}
+		if update.Message != nil {
+			return update, nil
+		}
+	}
+}
+
+// answer returns the text of a message or the value of the button answering a prompt
+func answer(update tgbotapi.Update) string {
+	if update.CallbackQuery != nil {
+		return strings.TrimPrefix(update.CallbackQuery.Data, "conv:")
+	}
+	return strings.TrimSpace(update.Message.Text)
+}
+
+// askText sends a prompt to the user and waits for a text answer
+func (b *Bot) askText(c *conversation, step, prompt string) (string, error) {
+	update, err := b.ask(c, step, prompt, nil)
+	if err != nil {
+		return "", err
+	}
+	return answer(update), nil
+}
+
+// HandleCancel handles the /cancel command, aborting the sender's active conversation
+func (b *Bot) HandleCancel(update tgbotapi.Update) {
+	text := "Nothing to cancel."
+	if b.conversations.cancel(keyForMessage(update.Message)) {
+		text = "Cancelled."
+	}
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending cancel message:", err)
+	}
+}
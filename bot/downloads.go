@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+	"github.com/Coolknight/transmission-telegram-bot/metainfo"
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/hekmon/cunits/v2"
+	"github.com/hekmon/transmissionrpc"
+)
+
+// presetsPerRow is the number of preset buttons shown in each keyboard row
+const presetsPerRow = 3
+
+// askDownloadPath offers the download presets as buttons and also accepts a preset name or a
+// free-text path. The answer is validated against Transmission and asked again until it is valid.
+// The intro, if any, is shown above the first prompt
+func (b *Bot) askDownloadPath(c *conversation, transmission *transmission.Client, intro string) (string, error) {
+	var keyboard *tgbotapi.InlineKeyboardMarkup
+	prompt := "Enter the download path:"
+	if len(b.downloads.Presets) > 0 {
+		presets := presetKeyboard(b.downloads.Presets)
+		keyboard = &presets
+		prompt = "Choose a destination or enter the download path:"
+	}
+	if intro != "" {
+		prompt = intro + "\n\n" + prompt
+	}
+
+	for {
+		update, err := b.ask(c, "download path", prompt, keyboard)
+		if err != nil {
+			return "", err
+		}
+
+		downloadPath, err := b.resolveDownloadPath(transmission, answer(update))
+		if err != nil {
+			log.Printf("Rejected download path: %v", err)
+			prompt = fmt.Sprintf("Invalid download path: %v\nChoose a destination or enter another path:", err)
+			continue
+		}
+
+		return downloadPath, nil
+	}
+}
+
+// resolveDownloadPath turns a preset name or a free-text path into a validated download path
+func (b *Bot) resolveDownloadPath(transmission *transmission.Client, text string) (string, error) {
+	downloadPath := text
+	if preset, ok := findPreset(b.downloads.Presets, text); ok {
+		downloadPath = preset.Path
+	}
+
+	downloadPath, freeSpace, err := transmission.ValidateDownloadDir(downloadPath, b.downloads.AllowedRoots)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Download path %s has %s free", downloadPath, freeSpace.GetHumanSizeRepresentation())
+	return downloadPath, nil
+}
+
+// checkDiskSpace checks a torrent fits in its download dir leaving the configured reserve free.
+// When it doesn't the user is told, and the torrent is either refused or to be added paused.
+// For torrents of unknown size, as most magnet links, only the reserve is checked
+func (b *Bot) checkDiskSpace(chatID int64, transmission *transmission.Client, downloadPath string, size int64) (paused, ok bool) {
+	reserve := cunits.ImportInGiB(b.diskGuard.ReserveGB)
+	if size <= 0 && reserve <= 0 {
+		return false, true
+	}
+
+	free, err := transmission.FreeSpace(downloadPath)
+	if err != nil {
+		log.Printf("Error getting free space of %s, adding the torrent anyway: %v", downloadPath, err)
+		return false, true
+	}
+
+	needed := reserve
+	if size > 0 {
+		needed += cunits.ImportInByte(float64(size))
+	}
+	if free >= needed {
+		return false, true
+	}
+
+	var text string
+	if size > 0 {
+		text = fmt.Sprintf("Not enough space in %s: %s free, the torrent needs %s", downloadPath,
+			free.GetHumanSizeRepresentation(), cunits.ImportInByte(float64(size)).GetHumanSizeRepresentation())
+		if reserve > 0 {
+			text += fmt.Sprintf(" and %s must stay free", reserve.GetHumanSizeRepresentation())
+		}
+	} else {
+		text = fmt.Sprintf("Not enough space in %s: %s free and %s must stay free", downloadPath,
+			free.GetHumanSizeRepresentation(), reserve.GetHumanSizeRepresentation())
+	}
+	log.Println(text)
+
+	if b.diskGuard.WhenShort == "pause" {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, text+".\nIt is added paused, /resume it once there is room."))
+		return true, true
+	}
+	b.BotAPI.Send(tgbotapi.NewMessage(chatID, text+".\nThe torrent has not been added."))
+	return false, false
+}
+
+// handleDuplicate tells the user the torrent is already in Transmission and offers to verify its
+// data again or to point it to another directory holding the data
+func (b *Bot) handleDuplicate(c *conversation, transmission *transmission.Client, existing *transmissionrpc.Torrent) error {
+	torrentID := *existing.ID
+	log.Printf("Torrent %d is already in Transmission", torrentID)
+
+	prompt := "This torrent is already in Transmission:\n" + formatTorrent(existing)
+	if existing.DownloadDir != nil {
+		prompt += "Saved in " + *existing.DownloadDir
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			conversationButton("Verify again", "verify"),
+			conversationButton("Point elsewhere", "relocate"),
+			conversationButton("Leave it", "leave"),
+		),
+	)
+
+	update, err := b.ask(c, "duplicate", prompt, &keyboard)
+	if err != nil {
+		return err
+	}
+
+	var text string
+	switch answer(update) {
+	case "verify":
+		text = runTorrentAction(transmission, "verify", []int64{torrentID})
+	case "relocate":
+		downloadPath, err := b.askDownloadPath(c, transmission, "Where is the data of this torrent?")
+		if err != nil {
+			return err
+		}
+		if err := transmission.RelocateTorrent(torrentID, downloadPath); err != nil {
+			log.Printf("Error relocating torrent %d: %v", torrentID, err)
+			text = fmt.Sprintf("Cannot point torrent #%d to %s: %v", torrentID, downloadPath, err)
+			break
+		}
+		// The data in the new place has to be checked before it can be seeded
+		text = fmt.Sprintf("Torrent #%d now points to %s.\n%s", torrentID, downloadPath,
+			runTorrentAction(transmission, "verify", []int64{torrentID}))
+	default:
+		text = fmt.Sprintf("Torrent #%d left untouched.", torrentID)
+	}
+
+	msg := tgbotapi.NewMessage(c.key.ChatID, text)
+	b.BotAPI.Send(msg)
+	return nil
+}
+
+// parseTorrent validates a magnet link or a downloaded torrent file before it reaches Transmission
+func parseTorrent(fileLink string) (*metainfo.Metainfo, error) {
+	if strings.HasPrefix(fileLink, "magnet:") {
+		return metainfo.ParseMagnet(fileLink)
+	}
+	return metainfo.ParseFile(fileLink)
+}
+
+// formatMetainfo summarizes a torrent for the user, e.g. "Name\n1.4 GiB in 3 files"
+func formatMetainfo(m *metainfo.Metainfo) string {
+	name := m.Name
+	if name == "" {
+		name = "Unnamed torrent " + m.Hash()
+	}
+
+	var details []string
+	if m.TotalSize > 0 {
+		details = append(details, cunits.ImportInByte(float64(m.TotalSize)).GetHumanSizeRepresentation())
+	}
+	if m.Files == 1 {
+		details = append(details, "1 file")
+	} else if m.Files > 1 {
+		details = append(details, fmt.Sprintf("%d files", m.Files))
+	}
+	if len(details) == 0 {
+		return name
+	}
+
+	return name + "\n" + strings.Join(details, " in ")
+}
+
+// findPreset looks a preset up by name, ignoring case
+func findPreset(presets []config.Preset, name string) (config.Preset, bool) {
+	for _, preset := range presets {
+		if strings.EqualFold(preset.Name, name) {
+			return preset, true
+		}
+	}
+	return config.Preset{}, false
+}
+
+// presetKeyboard builds the inline keyboard offering the download presets
+func presetKeyboard(presets []config.Preset) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, preset := range presets {
+		row = append(row, conversationButton(preset.Name, preset.Name))
+		if len(row) == presetsPerRow {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/Coolknight/transmission-telegram-bot/archives"
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// afterCompletion runs the post-download stages of a torrent in order, archives are extracted
+// before the hooks so these see the extracted files. It is run in its own goroutine so slow
+// stages don't hold the watcher up
+func (b *Bot) afterCompletion(chatID int64, event transmission.Event) {
+	extracted := b.extractArchives(chatID, event)
+	if b.library.Auto && event.Torrent.DownloadDir != nil && transmission.InDownloadDirs(*event.Torrent.DownloadDir, b.library.DownloadDirs) {
+		b.sortDownload(chatID, event.Torrent, extracted, false)
+	}
+	b.runHooks(chatID, event)
+}
+
+// extractArchives extracts the archives of a finished torrent, reporting the progress to the
+// chat by editing a single message. It returns the extracted files
+func (b *Bot) extractArchives(chatID int64, event transmission.Event) []string {
+	torrent := event.Torrent
+	if !b.extract.Enabled || torrent.DownloadDir == nil || torrent.Name == nil ||
+		!transmission.InDownloadDirs(*torrent.DownloadDir, b.extract.DownloadDirs) {
+		return nil
+	}
+
+	var files []string
+	for _, file := range torrent.Files {
+		files = append(files, filepath.Join(*torrent.DownloadDir, filepath.FromSlash(file.Name)))
+	}
+	found := archives.Find(files)
+	if len(found) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Extracting %d archives of %s\n", len(found), *torrent.Name)
+
+	var torrentDir string
+	if b.extract.Destination != "" {
+		var err error
+		if torrentDir, err = extractDir(b.extract.Destination, *torrent.Name); err != nil {
+			log.Printf("Not extracting torrent %d: %v", event.TorrentID, err)
+			fmt.Fprintf(&sb, "❌ %v\n", err)
+			b.sendProgress(chatID, 0, sb.String())
+			return nil
+		}
+	}
+	progress := b.sendProgress(chatID, 0, sb.String())
+
+	var extracted []string
+	for _, archive := range found {
+		destination := filepath.Dir(archive)
+		if torrentDir != "" {
+			destination = torrentDir
+		}
+
+		result, err := archives.Extract(archive, destination)
+		if err != nil {
+			log.Printf("Error extracting %s: %v", archive, err)
+			fmt.Fprintf(&sb, "❌ %s: %v\n", filepath.Base(archive), err)
+		} else {
+			log.Printf("Extracted %d files from %s to %s", result.Files, archive, destination)
+			fmt.Fprintf(&sb, "✅ %s: %d files, %s\n", filepath.Base(archive), result.Files, formatBytes(result.Bytes))
+			extracted = append(extracted, result.Paths...)
+		}
+		progress = b.sendProgress(chatID, progress, sb.String())
+	}
+
+	return extracted
+}
+
+// extractDir returns the directory named after a torrent under the extract destination. The name
+// comes from the torrent metainfo, so only its last element is kept and it must stay under the
+// destination, as archives do with the names of their files
+func extractDir(destination, name string) (string, error) {
+	base := filepath.Base(filepath.Clean(name))
+	if base == "." || base == ".." || base == string(filepath.Separator) {
+		return "", fmt.Errorf("the torrent name %q cannot be used as a directory", name)
+	}
+
+	destination = filepath.Clean(destination)
+	dir := filepath.Join(destination, base)
+	if !strings.HasPrefix(dir, destination+string(filepath.Separator)) {
+		return "", fmt.Errorf("the torrent name %q points outside of %s", name, destination)
+	}
+	return dir, nil
+}
+
+// sendProgress sends a progress message, or updates it once it has been sent, and returns its ID.
+// Nothing is sent to a zero chat
+func (b *Bot) sendProgress(chatID int64, messageID int, text string) int {
+	if chatID == 0 {
+		return 0
+	}
+
+	if messageID == 0 {
+		sent, err := b.BotAPI.Send(tgbotapi.NewMessage(chatID, text))
+		if err != nil {
+			log.Println("Error sending progress:", err)
+			return 0
+		}
+		return sent.MessageID
+	}
+
+	if _, err := b.BotAPI.Send(tgbotapi.NewEditMessageText(chatID, messageID, text)); err != nil {
+		log.Println("Error updating progress:", err)
+	}
+	return messageID
+}
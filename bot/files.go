@@ -0,0 +1,287 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/hekmon/cunits/v2"
+)
+
+// filesPageSize is the number of files shown in each page of the checklist
+const filesPageSize = 8
+
+// HandleFiles handles the /files <id> command, showing the file checklist of a torrent
+func (b *Bot) HandleFiles(update tgbotapi.Update, transmission *transmission.Client) {
+	chatID := update.Message.Chat.ID
+
+	torrentIDs, err := parseTorrentIDs(strings.Fields(update.Message.CommandArguments()))
+	if err != nil || len(torrentIDs) != 1 {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, "Usage: /files <id>"))
+		return
+	}
+
+	b.sendFileChecklist(chatID, transmission, torrentIDs[0])
+}
+
+// sendFileChecklist sends the first page of the file checklist of a torrent
+func (b *Bot) sendFileChecklist(chatID int64, transmission *transmission.Client, torrentID int64) {
+	text, keyboard, err := b.renderFileChecklist(transmission, torrentID, 0)
+	if err != nil {
+		log.Printf("Error listing files of torrent %d: %v", torrentID, err)
+		text = fmt.Sprintf("Cannot list the files of torrent #%d: %v", torrentID, err)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending file checklist:", err)
+	}
+}
+
+// HandleFilesButton handles the checklist buttons, their data is files:<action>:<id>:<page>[:<index>].
+// The show action sends a new checklist instead of updating the message
+func (b *Bot) HandleFilesButton(update tgbotapi.Update, transmission *transmission.Client) {
+	query := update.CallbackQuery
+	notice := ""
+	defer func() {
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, notice))
+	}()
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) < 4 {
+		log.Printf("Malformed files callback %q", query.Data)
+		return
+	}
+	action := parts[1]
+	torrentID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		log.Printf("Malformed files callback %q: %v", query.Data, err)
+		return
+	}
+	page, err := strconv.Atoi(parts[3])
+	if err != nil {
+		log.Printf("Malformed files callback %q: %v", query.Data, err)
+		return
+	}
+
+	switch action {
+	case "show":
+		// Opened from another message, such as a completion notification, which stays in place
+		b.sendFileChecklist(query.Message.Chat.ID, transmission, torrentID)
+		return
+	case "toggle", "priority":
+		if len(parts) != 5 {
+			log.Printf("Malformed files callback %q", query.Data)
+			return
+		}
+		index, err := strconv.Atoi(parts[4])
+		if err != nil {
+			log.Printf("Malformed files callback %q: %v", query.Data, err)
+			return
+		}
+		if notice, err = b.changeFile(transmission, torrentID, index, action); err != nil {
+			log.Printf("Error changing file %d of torrent %d: %v", index, torrentID, err)
+			notice = fmt.Sprintf("Cannot change the file: %v", err)
+		}
+	case "save":
+		if notice, err = b.saveFileRules(transmission, torrentID); err != nil {
+			log.Printf("Error saving file rules of torrent %d: %v", torrentID, err)
+			notice = fmt.Sprintf("Cannot save the rules: %v", err)
+		}
+	}
+
+	// Re-render from Transmission so the checklist shows what was actually applied
+	text, keyboard, err := b.renderFileChecklist(transmission, torrentID, page)
+	if err != nil {
+		log.Printf("Error listing files of torrent %d: %v", torrentID, err)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.BotAPI.Send(edit); err != nil {
+		log.Println("Error updating file checklist:", err)
+	}
+}
+
+// changeFile toggles whether a file is wanted or cycles its priority, changes are applied at once
+func (b *Bot) changeFile(client *transmission.Client, torrentID int64, index int, action string) (string, error) {
+	files, err := client.GetFiles(torrentID)
+	if err != nil {
+		return "", err
+	}
+	if index < 0 || index >= len(files) {
+		return "", fmt.Errorf("no file %d", index+1)
+	}
+
+	file := files[index]
+	indices := []int64{int64(index)}
+
+	if action == "toggle" {
+		return "", client.SetFilesWanted(torrentID, indices, !file.Wanted)
+	}
+
+	priority := transmission.PriorityLow
+	switch file.Priority {
+	case transmission.PriorityLow:
+		priority = transmission.PriorityNormal
+	case transmission.PriorityNormal:
+		priority = transmission.PriorityHigh
+	}
+	return "", client.SetFilesPriority(torrentID, indices, priority)
+}
+
+// saveFileRules stores the current selection as the file rules of the torrent's download preset
+func (b *Bot) saveFileRules(client *transmission.Client, torrentID int64) (string, error) {
+	torrent, err := client.GetTorrent(torrentID)
+	if err != nil {
+		return "", err
+	}
+	preset, ok := presetForPath(b.downloads.Presets, *torrent.DownloadDir)
+	if !ok {
+		return "The torrent is not in a preset destination.", nil
+	}
+
+	files, err := client.GetFiles(torrentID)
+	if err != nil {
+		return "", err
+	}
+
+	rules := transmission.RulesFromFiles(files)
+	if len(rules) == 0 {
+		return "Nothing to save, only whole file types can become rules.", nil
+	}
+
+	if err := b.fileRules.Set(preset.Name, rules); err != nil {
+		return "", err
+	}
+
+	log.Printf("Saved %d file rules for preset %s", len(rules), preset.Name)
+	return fmt.Sprintf("Saved %d rules for %s.", len(rules), preset.Name), nil
+}
+
+// renderFileChecklist builds the text and the buttons of a page of the file checklist
+func (b *Bot) renderFileChecklist(client *transmission.Client, torrentID int64, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	files, err := client.GetFiles(torrentID)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(files) == 0 {
+		return fmt.Sprintf("The files of torrent #%d are not known yet, try again once its metadata has been downloaded.", torrentID), nil, nil
+	}
+
+	pages := (len(files) + filesPageSize - 1) / filesPageSize
+	if page < 0 {
+		page = 0
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Files of torrent #%d, page %d/%d\n\n", torrentID, page+1, pages)
+
+	end := (page + 1) * filesPageSize
+	if end > len(files) {
+		end = len(files)
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i := page * filesPageSize; i < end; i++ {
+		file := files[i]
+		mark := "☐"
+		if file.Wanted {
+			mark = "☑"
+		}
+		fmt.Fprintf(&sb, "%d. %s %s (%s, %s priority)\n", i+1, mark, path.Base(file.Name),
+			cunits.ImportInByte(float64(file.Length)).GetHumanSizeRepresentation(), priorityName(file.Priority))
+
+		data := func(action string) string {
+			return fmt.Sprintf("files:%s:%d:%d:%d", action, torrentID, page, i)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d %s", i+1, mark), data("toggle")),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d %s", i+1, priorityName(file.Priority)), data("priority")),
+		))
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("« Prev", fmt.Sprintf("files:page:%d:%d", torrentID, page-1)))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("Save as rule", fmt.Sprintf("files:save:%d:%d", torrentID, page)))
+	if page < pages-1 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("Next »", fmt.Sprintf("files:page:%d:%d", torrentID, page+1)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons...))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return sb.String(), &keyboard, nil
+}
+
+// applyFileRules applies the file rules of the preset matching the download path, if any
+func (b *Bot) applyFileRules(client *transmission.Client, torrentID int64, downloadPath string) {
+	preset, ok := presetForPath(b.downloads.Presets, downloadPath)
+	if !ok {
+		return
+	}
+
+	matched, err := client.ApplyFileRules(torrentID, b.fileRules.Get(preset.Name))
+	if err != nil {
+		log.Printf("Error applying file rules of %s to torrent %d: %v", preset.Name, torrentID, err)
+		return
+	}
+	if matched > 0 {
+		log.Printf("File rules of %s applied to %d files of torrent %d", preset.Name, matched, torrentID)
+	}
+}
+
+// HandleTorrentMetadata applies the file rules and sends the file checklist of a torrent added
+// by magnet link, which has no files until Transmission fetched its metadata
+func (b *Bot) HandleTorrentMetadata(client *transmission.Client, event transmission.Event) {
+	if event.Type != transmission.EventMetadata {
+		return
+	}
+
+	if event.Torrent.DownloadDir != nil {
+		b.applyFileRules(client, event.TorrentID, *event.Torrent.DownloadDir)
+	}
+	files, err := client.GetFiles(event.TorrentID)
+	if err != nil {
+		log.Printf("Error listing files of torrent %d: %v", event.TorrentID, err)
+		return
+	}
+	if len(files) > 1 {
+		b.sendFileChecklist(event.ChatID, client, event.TorrentID)
+	}
+}
+
+// presetForPath returns the preset whose path is the download path
+func presetForPath(presets []config.Preset, downloadPath string) (config.Preset, bool) {
+	for _, preset := range presets {
+		if path.Clean(preset.Path) == path.Clean(downloadPath) {
+			return preset, true
+		}
+	}
+	return config.Preset{}, false
+}
+
+// priorityName renders a file priority
+func priorityName(priority int64) string {
+	switch priority {
+	case transmission.PriorityLow:
+		return "low"
+	case transmission.PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
@@ -0,0 +1,356 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+	"github.com/Coolknight/transmission-telegram-bot/feeds"
+	"github.com/Coolknight/transmission-telegram-bot/hooks"
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/hekmon/transmissionrpc"
+)
+
+// HandleWatcherEvent tells the chat that started a download about its progress
+func (b *Bot) HandleWatcherEvent(event transmission.Event) {
+	// Torrents added outside the bot have no chat of their own
+	if event.ChatID == 0 {
+		b.announce(event)
+		return
+	}
+
+	name := fmt.Sprintf("#%d", event.TorrentID)
+	if event.Torrent != nil && event.Torrent.Name != nil {
+		name = *event.Torrent.Name
+	}
+
+	var text string
+	var keyboard *tgbotapi.InlineKeyboardMarkup
+	switch event.Type {
+	case transmission.EventAdded:
+		log.Printf("Watching torrent %d for chat %d", event.TorrentID, event.ChatID)
+		return
+	case transmission.EventMetadata:
+		// Handled by HandleTorrentMetadata, which needs the Transmission client
+		return
+	case transmission.EventCompleted:
+		b.sendCompletion(event.ChatID, event.TorrentID, event.Torrent)
+		go b.afterCompletion(event.ChatID, event)
+		return
+	case transmission.EventStalled:
+		text = fmt.Sprintf("Download stalled, no progress for %s: %s\n%s", formatDuration(event.StalledFor), name, formatHealth(event.Torrent))
+		keyboard = troubleKeyboard(event.TorrentID)
+	case transmission.EventErrored:
+		text = "Download error: " + name
+		if event.Torrent.ErrorString != nil {
+			text += ": " + *event.Torrent.ErrorString
+		}
+		keyboard = troubleKeyboard(event.TorrentID)
+	case transmission.EventRemoved:
+		text = "Download removed before completing: " + name
+	}
+
+	log.Printf("Torrent %d %s", event.TorrentID, event.Type)
+	msg := tgbotapi.NewMessage(event.ChatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Printf("Error sending %s notification: %v", event.Type, err)
+	}
+}
+
+// runHooks runs the completion hooks of a torrent and reports how they went to the chat
+func (b *Bot) runHooks(chatID int64, event transmission.Event) {
+	if len(b.hooks) == 0 {
+		return
+	}
+
+	torrent := hooks.Torrent{ID: event.TorrentID, Name: fmt.Sprintf("#%d", event.TorrentID)}
+	if event.Torrent.Name != nil {
+		torrent.Name = *event.Torrent.Name
+	}
+	if event.Torrent.HashString != nil {
+		torrent.Hash = *event.Torrent.HashString
+	}
+	if event.Torrent.DownloadDir != nil {
+		torrent.DownloadDir = *event.Torrent.DownloadDir
+	}
+
+	results := hooks.Run(b.hooks, torrent)
+	if len(results) == 0 {
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Hooks for %s:\n", torrent.Name)
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("Hook %s failed for torrent %d: %v\n%s", result.Name, torrent.ID, result.Err, result.Output)
+			fmt.Fprintf(&sb, "❌ %s: %v\n", result.Name, result.Err)
+			if result.Output != "" {
+				fmt.Fprintf(&sb, "%s\n", result.Output)
+			}
+			continue
+		}
+		log.Printf("Hook %s done for torrent %d in %s\n%s", result.Name, torrent.ID, result.Duration, result.Output)
+		fmt.Fprintf(&sb, "✅ %s (%s)\n", result.Name, formatDuration(result.Duration))
+	}
+
+	if chatID == 0 {
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending hook results:", err)
+	}
+}
+
+// modeMarkdownV2 is the Telegram parse mode escaping every special character, the bot API
+// library predates it
+const modeMarkdownV2 = "MarkdownV2"
+
+// sendCompletion tells the chat a download finished, with a summary of how it went
+func (b *Bot) sendCompletion(chatID, torrentID int64, torrent *transmissionrpc.Torrent) {
+	msg := tgbotapi.NewMessage(chatID, formatCompletion(torrentID, torrent))
+	msg.ParseMode = modeMarkdownV2
+	msg.ReplyMarkup = completionKeyboard(torrentID)
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Printf("Error sending completed notification: %v", err)
+	}
+}
+
+// formatCompletion renders the summary of a finished download in MarkdownV2, leaving out
+// whatever Transmission did not report
+func formatCompletion(torrentID int64, torrent *transmissionrpc.Torrent) string {
+	name := fmt.Sprintf("#%d", torrentID)
+	if torrent != nil && torrent.Name != nil {
+		name = *torrent.Name
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✅ *Download completed*\n%s\n", escapeMarkdown(name))
+	if torrent == nil {
+		return sb.String()
+	}
+
+	if torrent.SizeWhenDone != nil {
+		size := torrent.SizeWhenDone.GetHumanSizeRepresentation()
+		if len(torrent.Files) > 0 {
+			size = fmt.Sprintf("%s in %d files", size, len(torrent.Files))
+		}
+		fmt.Fprintf(&sb, "\n*Size:* %s", escapeMarkdown(size))
+	}
+
+	// A zero done date means Transmission does not know, e.g. for torrents added already complete
+	if torrent.AddedDate != nil && torrent.DoneDate != nil && torrent.DoneDate.Unix() > 0 && torrent.DoneDate.After(*torrent.AddedDate) {
+		took := torrent.DoneDate.Sub(*torrent.AddedDate)
+		text := formatDuration(took)
+		if torrent.SizeWhenDone != nil {
+			rate := int64(torrent.SizeWhenDone.Byte() / took.Seconds())
+			text = fmt.Sprintf("%s at %s/s on average", text, formatBytes(rate))
+		}
+		fmt.Fprintf(&sb, "\n*Took:* %s", escapeMarkdown(text))
+	}
+
+	if torrent.UploadRatio != nil && *torrent.UploadRatio >= 0 {
+		fmt.Fprintf(&sb, "\n*Ratio:* %s", escapeMarkdown(fmt.Sprintf("%.2f", *torrent.UploadRatio)))
+	}
+
+	if torrent.DownloadDir != nil {
+		fmt.Fprintf(&sb, "\n*Saved in:* `%s`", escapeCode(*torrent.DownloadDir))
+	}
+
+	return sb.String()
+}
+
+// completionKeyboard offers to look at the files of a finished download or to remove it
+func completionKeyboard(torrentID int64) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Files", fmt.Sprintf("files:show:%d:0", torrentID)),
+			tgbotapi.NewInlineKeyboardButtonData("Remove", fmt.Sprintf("torrent:remove:%d", torrentID)),
+			tgbotapi.NewInlineKeyboardButtonData("Remove with data", fmt.Sprintf("torrent:askpurge:%d", torrentID)),
+		),
+	)
+}
+
+// markdownEscaper escapes the characters MarkdownV2 reserves outside of code
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)", "~", "\\~",
+	"`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=", "|", "\\|", "{", "\\{",
+	"}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// escapeMarkdown makes text safe to embed in a MarkdownV2 message
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// escapeCode makes text safe to embed in a MarkdownV2 code span, where only ` and \ are special
+func escapeCode(text string) string {
+	return strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(text)
+}
+
+// formatHealth renders what the stalled torrent is doing, e.g. "99.2% done, 0 peers, 0 B/s"
+func formatHealth(torrent *transmissionrpc.Torrent) string {
+	var parts []string
+	if torrent.PercentDone != nil {
+		parts = append(parts, fmt.Sprintf("%.1f%% done", *torrent.PercentDone*100))
+	}
+	if torrent.PeersConnected != nil {
+		parts = append(parts, fmt.Sprintf("%d peers", *torrent.PeersConnected))
+	}
+	if torrent.RateDownload != nil {
+		parts = append(parts, formatBytes(*torrent.RateDownload)+"/s")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// troubleKeyboard offers the actions that usually unstick a torrent, they are handled as torrent menu buttons
+func troubleKeyboard(torrentID int64) *tgbotapi.InlineKeyboardMarkup {
+	data := func(action string) string {
+		return fmt.Sprintf("torrent:%s:%d", action, torrentID)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Reannounce", data("reannounce")),
+		tgbotapi.NewInlineKeyboardButtonData("Verify", data("verify")),
+		tgbotapi.NewInlineKeyboardButtonData("Remove", data("remove")),
+	))
+	return &keyboard
+}
+
+// announce tells the announcement chats about a torrent added or completed outside the bot
+func (b *Bot) announce(event transmission.Event) {
+	var text string
+	switch event.Type {
+	case transmission.EventAdded:
+		text = "New torrent: " + *event.Torrent.Name
+	case transmission.EventCompleted:
+		text = "Torrent completed: " + *event.Torrent.Name
+		go b.afterCompletion(b.auth.adminChatID, event)
+	default:
+		return
+	}
+
+	downloadDir := ""
+	if event.Torrent.DownloadDir != nil {
+		downloadDir = *event.Torrent.DownloadDir
+	}
+
+	for _, chat := range b.announceChats {
+		if !transmission.InDownloadDirs(downloadDir, chat.DownloadDirs) {
+			continue
+		}
+
+		msg := tgbotapi.NewMessage(chat.ID, text)
+		if _, err := b.BotAPI.Send(msg); err != nil {
+			log.Printf("Error announcing torrent %d to chat %d: %v", event.TorrentID, chat.ID, err)
+		}
+	}
+}
+
+// HandleSeedingRemovals sends the admin chat a summary of the torrents removed by their seeding policy
+func (b *Bot) HandleSeedingRemovals(removals []transmission.SeedingRemoval) {
+	if b.auth.adminChatID == 0 {
+		log.Printf("No admin chat to report %d torrents removed after seeding", len(removals))
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Removed %d torrents that finished seeding:\n", len(removals))
+	for _, removal := range removals {
+		fmt.Fprintf(&sb, "- %s (%s, ratio %.2f", removal.Name, removal.Policy, removal.Ratio)
+		if removal.DeletedData {
+			sb.WriteString(", data deleted")
+		}
+		sb.WriteString(")\n")
+	}
+
+	msg := tgbotapi.NewMessage(b.auth.adminChatID, sb.String())
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending seeding summary:", err)
+	}
+}
+
+// HandleFeedAdditions sends the admin chat the items the feed poller added, or gave up on. The
+// added ones are watched so the admin chat is told when they complete
+func (b *Bot) HandleFeedAdditions(additions []feeds.Addition) {
+	if b.auth.adminChatID == 0 {
+		log.Printf("No admin chat to report %d items from the RSS feeds", len(additions))
+		return
+	}
+
+	if b.feedWatcher != nil {
+		for _, addition := range additions {
+			if addition.Err == nil {
+				b.feedWatcher.Watch(addition.TorrentID, b.auth.adminChatID)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("From the RSS feeds:\n")
+	for _, addition := range additions {
+		if addition.Err != nil {
+			fmt.Fprintf(&sb, "- ⚠️ %s (%s) could not be added: %v\n", addition.Title, addition.Feed, addition.Err)
+			continue
+		}
+		if addition.Paused {
+			fmt.Fprintf(&sb, "- ⏸ #%d %s (%s), added paused for lack of space\n", addition.TorrentID, addition.Title, addition.Feed)
+			continue
+		}
+		fmt.Fprintf(&sb, "- #%d %s (%s)\n", addition.TorrentID, addition.Title, addition.Feed)
+	}
+
+	msg := tgbotapi.NewMessage(b.auth.adminChatID, sb.String())
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending RSS summary:", err)
+	}
+}
+
+// HandleDiskAlert tells the admin chat a download dir is running out of space, or has enough again
+func (b *Bot) HandleDiskAlert(alert transmission.DiskAlert) {
+	if b.auth.adminChatID == 0 {
+		return
+	}
+
+	var text string
+	switch {
+	case alert.Recovered:
+		text = fmt.Sprintf("%s has %s free again. Paused downloads have to be resumed with /resume.",
+			alert.Dir, alert.Free.GetHumanSizeRepresentation())
+	case len(alert.Paused) > 0:
+		text = fmt.Sprintf("⚠️ Only %s free in %s, paused %s.", alert.Free.GetHumanSizeRepresentation(), alert.Dir,
+			formatTorrentIDs(alert.Paused))
+	default:
+		text = fmt.Sprintf("⚠️ Only %s free in %s.", alert.Free.GetHumanSizeRepresentation(), alert.Dir)
+	}
+
+	msg := tgbotapi.NewMessage(b.auth.adminChatID, text)
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending disk alert:", err)
+	}
+}
+
+// announceChats returns the chats hearing about torrents added outside the bot, the admin
+// chat hears about all of them unless some chats are configured
+func announceChats(cfg config.Telegram) []config.AnnounceChat {
+	if !cfg.Announce.Enabled {
+		return nil
+	}
+	if len(cfg.Announce.Chats) > 0 {
+		return cfg.Announce.Chats
+	}
+
+	chatID, err := strconv.ParseInt(cfg.ChatID, 10, 64)
+	if err != nil {
+		log.Printf("Invalid telegram chatID %q, torrents won't be announced: %v", cfg.ChatID, err)
+		return nil
+	}
+	return []config.AnnounceChat{{ID: chatID}}
+}
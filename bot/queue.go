@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// queueUsage explains the /queue subcommands
+const queueUsage = "Usage: /queue [top|up|down|bottom <id...>] [size <n|off>]"
+
+// HandleQueue handles the /queue command, showing the download queue, moving torrents in it
+// or changing how many torrents are downloaded at once
+func (b *Bot) HandleQueue(update tgbotapi.Update, client *transmission.Client) {
+	chatID := update.Message.Chat.ID
+	args := strings.Fields(strings.ToLower(update.Message.CommandArguments()))
+
+	if len(args) == 0 {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, renderQueue(client)))
+		return
+	}
+
+	switch args[0] {
+	case "top", "up", "down", "bottom":
+		torrentIDs, err := parseTorrentIDs(args[1:])
+		if err != nil || len(torrentIDs) == 0 {
+			b.BotAPI.Send(tgbotapi.NewMessage(chatID, queueUsage))
+			return
+		}
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, runTorrentAction(client, args[0], torrentIDs)))
+	case "size":
+		if len(args) != 2 {
+			b.BotAPI.Send(tgbotapi.NewMessage(chatID, queueUsage))
+			return
+		}
+		size, ok := parseLimit(args[1])
+		if !ok {
+			b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%q is not a number of torrents nor off", args[1])))
+			return
+		}
+		if err := client.SetDownloadQueueSize(size); err != nil {
+			log.Println("Error changing the download queue size:", err)
+			b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Transmission refused the queue size: %v", err)))
+			return
+		}
+		log.Printf("Download queue size set to %d", size)
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, renderQueue(client)))
+	default:
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, queueUsage))
+	}
+}
+
+// HandlePriority handles the /priority <high|normal|low> <id...> command
+func (b *Bot) HandlePriority(update tgbotapi.Update, client *transmission.Client) {
+	chatID := update.Message.Chat.ID
+	args := strings.Fields(strings.ToLower(update.Message.CommandArguments()))
+
+	if len(args) < 2 || (args[0] != "high" && args[0] != "normal" && args[0] != "low") {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, "Usage: /priority <high|normal|low> <id> [<id>...]"))
+		return
+	}
+	torrentIDs, err := parseTorrentIDs(args[1:])
+	if err != nil {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, err.Error()))
+		return
+	}
+
+	b.BotAPI.Send(tgbotapi.NewMessage(chatID, runTorrentAction(client, args[0], torrentIDs)))
+}
+
+// renderQueue lists the torrents waiting to download in queue order along with the queue size
+func renderQueue(client *transmission.Client) string {
+	size, err := client.GetDownloadQueueSize()
+	if err != nil {
+		log.Println("Error getting the download queue size:", err)
+		return fmt.Sprintf("Cannot get the download queue: %v", err)
+	}
+	torrents, err := client.ListQueue()
+	if err != nil {
+		log.Println("Error listing the download queue:", err)
+		return fmt.Sprintf("Cannot get the download queue: %v", err)
+	}
+
+	var sb strings.Builder
+	if size > 0 {
+		fmt.Fprintf(&sb, "Downloading %d torrents at once.\n\n", size)
+	} else {
+		sb.WriteString("The download queue is disabled, every torrent downloads at once.\n\n")
+	}
+
+	if len(torrents) == 0 {
+		sb.WriteString("Nothing is downloading.")
+		return sb.String()
+	}
+	for _, torrent := range torrents {
+		sb.WriteString(formatTorrent(torrent))
+	}
+	return sb.String()
+}
@@ -0,0 +1,455 @@
+package bot
+
+import (
+	"fmt"
+	"hash/crc32"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Coolknight/transmission-telegram-bot/dockerhandler"
+	"github.com/Coolknight/transmission-telegram-bot/feeds"
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	"github.com/Coolknight/transmission-telegram-bot/yamlhandler"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	// rssUsage explains the /rss subcommands
+	rssUsage = "Usage: /rss [add|list|edit <n>|remove <n>]"
+	// feedTimeout bounds the time waited for a feed being checked
+	feedTimeout = 30 * time.Second
+	// feedPreview is the number of item titles shown before saving a feed
+	feedPreview = 5
+)
+
+// HandleRSS handles the /rss command: add, the default, asks for a new feed, list shows the
+// feeds, edit and remove act on the feed numbered as in the list
+func (b *Bot) HandleRSS(update tgbotapi.Update, transmission *transmission.Client) {
+	chatID := update.Message.Chat.ID
+	args := strings.Fields(update.Message.CommandArguments())
+
+	subcommand := "add"
+	if len(args) > 0 {
+		subcommand = strings.ToLower(args[0])
+	}
+
+	switch subcommand {
+	case "add":
+		b.converse(update.Message, func(c *conversation) error {
+			return b.HandleRSSAdition(c, transmission)
+		})
+		return
+
+	case "list":
+		text, keyboard, err := renderFeeds()
+		b.sendFeedMessage(chatID, text, keyboard, err)
+		return
+
+	case "edit", "remove":
+		if len(args) != 2 {
+			break
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			break
+		}
+
+		feeds, err := yamlhandler.ListFeeds()
+		if err == nil && (n < 1 || n > len(feeds)) {
+			err = fmt.Errorf("there is no feed %d, see /rss list", n)
+		}
+		if err != nil {
+			b.sendFeedMessage(chatID, "", nil, err)
+			return
+		}
+
+		var text string
+		var keyboard *tgbotapi.InlineKeyboardMarkup
+		if subcommand == "edit" {
+			text, keyboard = renderFeed(feeds[n-1], n-1)
+		} else {
+			text, keyboard = renderFeedRemoval(feeds[n-1], n-1)
+		}
+		b.sendFeedMessage(chatID, text, keyboard, nil)
+		return
+	}
+
+	b.BotAPI.Send(tgbotapi.NewMessage(chatID, rssUsage))
+}
+
+// sendFeedMessage sends a feed list or menu, or the error that prevented building it
+func (b *Bot) sendFeedMessage(chatID int64, text string, keyboard *tgbotapi.InlineKeyboardMarkup, err error) {
+	if err != nil {
+		log.Printf("Error reading feeds: %v", err)
+		text = fmt.Sprintf("Cannot read the feeds: %v", err)
+		keyboard = nil
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending feeds:", err)
+	}
+}
+
+// HandleRSSButton handles the buttons of the feed list and menus. Their data is rss:list or
+// rss:<action>:<index>:<tag>, the tag tells whether the feed at that index is still the same
+func (b *Bot) HandleRSSButton(update tgbotapi.Update, transmission *transmission.Client) {
+	query := update.CallbackQuery
+	chatID := query.Message.Chat.ID
+	messageID := query.Message.MessageID
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) == 2 && parts[1] == "list" {
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		text, keyboard, err := renderFeeds()
+		b.editFeedMessage(chatID, messageID, text, keyboard, err)
+		return
+	}
+
+	index, feed, err := feedForCallback(parts)
+	if err != nil {
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, err.Error()))
+		return
+	}
+
+	switch parts[1] {
+	case "edit":
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		text, keyboard := renderFeed(feed, index)
+		b.editFeedMessage(chatID, messageID, text, keyboard, nil)
+
+	case "remove":
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		text, keyboard := renderFeedRemoval(feed, index)
+		b.editFeedMessage(chatID, messageID, text, keyboard, nil)
+
+	case "delete":
+		if _, err := yamlhandler.RemoveFeed(index); err != nil {
+			log.Printf("Error removing feed %s: %v", feed.URL, err)
+			b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, fmt.Sprintf("Cannot remove the feed: %v", err)))
+			return
+		}
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Feed removed."))
+		b.feedsChanged(chatID, messageID)
+
+	case "toggle":
+		if _, err := yamlhandler.SetFeedEnabled(index, !feed.Enabled); err != nil {
+			log.Printf("Error toggling feed %s: %v", feed.URL, err)
+			b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, fmt.Sprintf("Cannot change the feed: %v", err)))
+			return
+		}
+		text := "Feed resumed."
+		if feed.Enabled {
+			text = "Feed paused."
+		}
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, text))
+		b.feedsChanged(chatID, messageID)
+
+	case "url", "path":
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		b.converseWith(keyForCallback(query), func(c *conversation) error {
+			return b.editFeed(c, transmission, index, feed, parts[1])
+		})
+
+	default:
+		log.Printf("Malformed rss callback %q", query.Data)
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+	}
+}
+
+// editFeed asks for the new URL or download path of a feed and saves it
+func (b *Bot) editFeed(c *conversation, transmission *transmission.Client, index int, feed yamlhandler.Feed, field string) error {
+	updated := feed
+	if field == "url" {
+		url, err := b.askFeedURL(c, fmt.Sprintf("Current URL:\n%s\n\nEnter the new RSS url:", feed.URL), index)
+		if err != nil || url == "" {
+			return err
+		}
+		updated.URL = url
+	} else {
+		downloadPath, err := b.askDownloadPath(c, transmission, "Current download path: "+feed.DownloadPath)
+		if err != nil {
+			return err
+		}
+		updated.DownloadPath = downloadPath
+	}
+
+	// The feeds may have changed while the user was typing
+	feeds, err := yamlhandler.ListFeeds()
+	if err != nil {
+		return err
+	}
+	if index >= len(feeds) || !reflect.DeepEqual(feeds[index], feed) {
+		b.BotAPI.Send(tgbotapi.NewMessage(c.key.ChatID, "The feeds changed in the meantime, nothing was saved. See /rss list."))
+		return nil
+	}
+
+	changed, err := yamlhandler.UpdateFeed(index, updated)
+	if err != nil {
+		return fmt.Errorf("error updating feed: %v", err)
+	}
+	if !changed {
+		b.BotAPI.Send(tgbotapi.NewMessage(c.key.ChatID, "Nothing changed."))
+		return nil
+	}
+	if err := b.reloadFeeds(); err != nil {
+		return err
+	}
+
+	text, keyboard := renderFeed(updated, index)
+	b.sendFeedMessage(c.key.ChatID, "Feed updated!\n\n"+text, keyboard, nil)
+	return nil
+}
+
+// askFeedURL asks for the URL of a feed until it gets one that is not in the list yet, besides the
+// feed at skip, and that has torrents. It then shows the feed and asks for confirmation, returning
+// an empty URL when the user declines
+func (b *Bot) askFeedURL(c *conversation, prompt string, skip int) (string, error) {
+	for {
+		feedURL, err := b.askText(c, "rss url", prompt)
+		if err != nil {
+			return "", err
+		}
+
+		feed, err := checkFeed(feedURL, skip)
+		if err != nil {
+			log.Printf("Rejected feed %s: %v", feedURL, err)
+			prompt = fmt.Sprintf("Invalid feed: %v\nEnter another RSS url:", err)
+			continue
+		}
+
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				conversationButton("Save it", "save"),
+				conversationButton("Another URL", "retry"),
+				conversationButton("Cancel", "cancel"),
+			),
+		)
+		update, err := b.ask(c, "rss confirm", formatFeedPreview(feed), &keyboard)
+		if err != nil {
+			return "", err
+		}
+
+		switch answer(update) {
+		case "save":
+			return feedURL, nil
+		case "retry":
+			prompt = "Enter the RSS url:"
+		default:
+			b.BotAPI.Send(tgbotapi.NewMessage(c.key.ChatID, "The feed has not been saved."))
+			return "", nil
+		}
+	}
+}
+
+// checkFeed fetches a feed and makes sure it is new and has torrents
+func checkFeed(feedURL string, skip int) (*feeds.Feed, error) {
+	existing, err := yamlhandler.ListFeeds()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the feeds: %v", err)
+	}
+	for i, feed := range existing {
+		if i != skip && strings.TrimRight(feed.URL, "/") == strings.TrimRight(feedURL, "/") {
+			return nil, fmt.Errorf("it is already feed %d", i+1)
+		}
+	}
+
+	feed, err := feeds.Fetch(feedURL, feedTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(feed.Items) == 0 {
+		return nil, fmt.Errorf("%q has no items", feed.Title)
+	}
+	if len(feed.Torrents()) == 0 {
+		return nil, fmt.Errorf("none of the %d items of %q has a torrent or magnet link", len(feed.Items), feed.Title)
+	}
+	return feed, nil
+}
+
+// formatFeedPreview shows the title and last items of a feed
+func formatFeedPreview(feed *feeds.Feed) string {
+	title := feed.Title
+	if title == "" {
+		title = "Untitled feed"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n%d items, %d with torrents. Latest:\n", title, len(feed.Items), len(feed.Torrents()))
+	for i, item := range feed.Items {
+		if i == feedPreview {
+			break
+		}
+		fmt.Fprintf(&sb, "• %s\n", item.Title)
+	}
+	sb.WriteString("\nSave this feed?")
+	return sb.String()
+}
+
+// feedsChanged reloads the feeds after a change and shows the feed list again in the message
+// whose button made the change
+func (b *Bot) feedsChanged(chatID int64, messageID int) {
+	if err := b.reloadFeeds(); err != nil {
+		log.Println(err)
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("The feeds were saved but %v", err)))
+	}
+
+	text, keyboard, err := renderFeeds()
+	b.editFeedMessage(chatID, messageID, text, keyboard, err)
+}
+
+// SetFeedPoller makes the bot rely on the built-in poller instead of the transmission-rss
+// container, the items it adds are watched on behalf of the admin chat. It must be called before
+// Start
+func (b *Bot) SetFeedPoller(poller *feeds.Poller, watcher *transmission.Watcher) {
+	b.feedPoller = poller
+	b.feedWatcher = watcher
+}
+
+// reloadFeeds makes a change to the feeds take effect: the built-in poller reads them again right
+// away, while the transmission-rss container has to be restarted
+func (b *Bot) reloadFeeds() error {
+	if b.feedPoller != nil {
+		b.feedPoller.Wake()
+		return nil
+	}
+
+	log.Printf("Restarting Transmission-rss Docker...")
+	if err := dockerhandler.RestartContainer("transmission-rss"); err != nil {
+		return fmt.Errorf("error restarting rss docker: %v", err)
+	}
+	log.Printf("Done.\n")
+	return nil
+}
+
+// editFeedMessage replaces a feed list or menu with another one
+func (b *Bot) editFeedMessage(chatID int64, messageID int, text string, keyboard *tgbotapi.InlineKeyboardMarkup, err error) {
+	if err != nil {
+		log.Printf("Error reading feeds: %v", err)
+		text = fmt.Sprintf("Cannot read the feeds: %v", err)
+		keyboard = nil
+	}
+
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.BotAPI.Send(edit); err != nil {
+		log.Println("Error updating feeds:", err)
+	}
+}
+
+// feedForCallback finds the feed a button refers to, making sure it is still at the same index
+func feedForCallback(parts []string) (int, yamlhandler.Feed, error) {
+	if len(parts) != 4 {
+		return 0, yamlhandler.Feed{}, fmt.Errorf("malformed button")
+	}
+	index, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, yamlhandler.Feed{}, fmt.Errorf("malformed button")
+	}
+
+	feeds, err := yamlhandler.ListFeeds()
+	if err != nil {
+		return 0, yamlhandler.Feed{}, fmt.Errorf("cannot read the feeds: %v", err)
+	}
+	if index < 0 || index >= len(feeds) || feedTag(feeds[index]) != parts[3] {
+		return 0, yamlhandler.Feed{}, fmt.Errorf("the feeds changed, list them again")
+	}
+	return index, feeds[index], nil
+}
+
+// feedTag is a short checksum of a feed that fits in the button data
+func feedTag(feed yamlhandler.Feed) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(feed.URL+"\x00"+feed.DownloadPath)))
+}
+
+// feedButton builds a button acting on a feed
+func feedButton(text, action string, feed yamlhandler.Feed, index int) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, fmt.Sprintf("rss:%s:%d:%s", action, index, feedTag(feed)))
+}
+
+// renderFeeds builds the feed list, with a button opening the menu of each feed
+func renderFeeds() (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	feeds, err := yamlhandler.ListFeeds()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(feeds) == 0 {
+		return "There are no feeds, add one with /rss add.", nil, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("RSS feeds:\n\n")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for i, feed := range feeds {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, formatFeed(feed))
+
+		row = append(row, feedButton(strconv.Itoa(i+1), "edit", feed, i))
+		if len(row) == 5 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return sb.String(), &keyboard, nil
+}
+
+// renderFeed builds the menu of a feed
+func renderFeed(feed yamlhandler.Feed, index int) (string, *tgbotapi.InlineKeyboardMarkup) {
+	toggle := "Pause"
+	if !feed.Enabled {
+		toggle = "Resume"
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			feedButton("Change URL", "url", feed, index),
+			feedButton("Change path", "path", feed, index),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			feedButton(toggle, "toggle", feed, index),
+			feedButton("Remove", "remove", feed, index),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("« Feeds", "rss:list"),
+		),
+	)
+	return fmt.Sprintf("Feed %d. %s", index+1, formatFeed(feed)), &keyboard
+}
+
+// renderFeedRemoval asks for confirmation before removing a feed
+func renderFeedRemoval(feed yamlhandler.Feed, index int) (string, *tgbotapi.InlineKeyboardMarkup) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			feedButton("Yes, remove it", "delete", feed, index),
+			feedButton("No", "edit", feed, index),
+		),
+	)
+	return fmt.Sprintf("Remove feed %d?\n%s", index+1, formatFeed(feed)), &keyboard
+}
+
+// formatFeed shows a feed with its state and download path
+func formatFeed(feed yamlhandler.Feed) string {
+	state := "▶️"
+	if !feed.Enabled {
+		state = "⏸"
+	}
+	text := fmt.Sprintf("%s %s\n    → %s", state, feed.URL, feed.DownloadPath)
+	if len(feed.Include) > 0 {
+		text += "\n    only: " + strings.Join(feed.Include, ", ")
+	}
+	if len(feed.Exclude) > 0 {
+		text += "\n    except: " + strings.Join(feed.Exclude, ", ")
+	}
+	return text
+}
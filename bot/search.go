@@ -0,0 +1,200 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Coolknight/transmission-telegram-bot/torznab"
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	// searchHits is the number of results shown for a search
+	searchHits = 8
+	// searchTimeout bounds the time waited for the indexers and for a torrent link
+	searchTimeout = 30 * time.Second
+	// maxSearches is the number of searches whose buttons keep working
+	maxSearches = 20
+)
+
+// searchCache keeps the results of the last searches so their buttons, which can only carry
+// a few bytes, can refer to them by number
+type searchCache struct {
+	mu      sync.Mutex
+	next    int
+	results map[int][]torznab.Result
+}
+
+func newSearchCache() *searchCache {
+	return &searchCache{results: make(map[int][]torznab.Result)}
+}
+
+// add stores the results of a search and returns its number, the oldest search is forgotten
+// once there are too many
+func (s *searchCache) add(results []torznab.Result) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next++
+	s.results[s.next] = results
+	delete(s.results, s.next-maxSearches)
+	return s.next
+}
+
+// get returns a result of a search
+func (s *searchCache) get(search, hit int) (torznab.Result, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := s.results[search]
+	if hit < 0 || hit >= len(results) {
+		return torznab.Result{}, false
+	}
+	return results[hit], true
+}
+
+// HandleSearch handles the /search <query> command, showing the best results of the indexers
+// with buttons to download them
+func (b *Bot) HandleSearch(update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	query := strings.TrimSpace(update.Message.CommandArguments())
+	if query == "" {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, "Usage: /search <query>"))
+		return
+	}
+	if len(b.indexers) == 0 {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, "No indexers are configured."))
+		return
+	}
+
+	// The indexers can be slow, don't hold the other updates up
+	go func() {
+		results, errs := torznab.Search(b.indexers, query, searchTimeout)
+		for _, err := range errs {
+			log.Printf("Error searching %q: %v", query, err)
+		}
+
+		var sb strings.Builder
+		for _, err := range errs {
+			fmt.Fprintf(&sb, "⚠️ %v\n", err)
+		}
+		if len(results) == 0 {
+			fmt.Fprintf(&sb, "Nothing found for %q.", query)
+			b.BotAPI.Send(tgbotapi.NewMessage(chatID, sb.String()))
+			return
+		}
+
+		if len(results) > searchHits {
+			results = results[:searchHits]
+		}
+		search := b.searches.add(results)
+
+		fmt.Fprintf(&sb, "Results for %q:\n\n", query)
+		for i, result := range results {
+			fmt.Fprintf(&sb, "%d. %s\n    %s, %d seeders, %s\n", i+1, result.Title, formatBytes(result.Size), result.Seeders, result.Indexer)
+		}
+
+		msg := tgbotapi.NewMessage(chatID, sb.String())
+		msg.ReplyMarkup = b.searchKeyboard(search, len(results))
+		if _, err := b.BotAPI.Send(msg); err != nil {
+			log.Println("Error sending search results:", err)
+		}
+	}()
+}
+
+// searchKeyboard builds a row of buttons per result, one per download preset, or a single one
+// asking for the destination when there are no presets. Their data is search:<search>:<hit>:<preset>
+func (b *Bot) searchKeyboard(search, hits int) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for hit := 0; hit < hits; hit++ {
+		data := func(preset int) string {
+			return fmt.Sprintf("search:%d:%d:%d", search, hit, preset)
+		}
+
+		var row []tgbotapi.InlineKeyboardButton
+		for i, preset := range b.downloads.Presets {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d → %s", hit+1, preset.Name), data(i)))
+		}
+		if len(row) == 0 {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Download %d", hit+1), data(-1)))
+		}
+		rows = append(rows, row)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// HandleSearchButton downloads a search result, it goes through the same checks as a torrent
+// sent by the user in a conversation with whoever pressed the button
+func (b *Bot) HandleSearchButton(update tgbotapi.Update, transmission *transmission.Client, watcher *transmission.Watcher) {
+	query := update.CallbackQuery
+
+	parts := strings.Split(query.Data, ":")
+	var search, hit, preset int
+	var err error
+	if len(parts) == 4 {
+		search, err = strconv.Atoi(parts[1])
+		if err == nil {
+			hit, err = strconv.Atoi(parts[2])
+		}
+		if err == nil {
+			preset, err = strconv.Atoi(parts[3])
+		}
+	}
+	if len(parts) != 4 || err != nil {
+		log.Printf("Malformed search callback %q", query.Data)
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	result, ok := b.searches.get(search, hit)
+	if !ok {
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "This search has expired, search again."))
+		return
+	}
+	destination := ""
+	if preset >= 0 && preset < len(b.downloads.Presets) {
+		destination = b.downloads.Presets[preset].Name
+	}
+	b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Downloading "+result.Title))
+
+	b.converseWith(keyForCallback(query), func(c *conversation) error {
+		fileLink, err := fetchResult(result, fmt.Sprintf("search-%d-%d", search, hit))
+		if err != nil {
+			log.Printf("Error fetching %s: %v", torznab.Redact(result.Link), err)
+			b.BotAPI.Send(tgbotapi.NewMessage(c.key.ChatID, fmt.Sprintf("Cannot get %s from %s: %v", result.Title, result.Indexer, err)))
+			return nil
+		}
+		// Anything but a magnet link was saved under torrents/ by fetchResult
+		saved := !strings.HasPrefix(fileLink, "magnet:")
+		return handleDownload(b, c, transmission, watcher, fileLink, saved, destination)
+	})
+}
+
+// fetchResult returns the magnet link of a search result, or the path of its .torrent file
+// once downloaded into the torrents folder
+func fetchResult(result torznab.Result, name string) (string, error) {
+	magnet, data, err := torznab.Fetch(result.Link, searchTimeout)
+	if err != nil {
+		return "", err
+	}
+	if magnet != "" {
+		return magnet, nil
+	}
+
+	if err := os.MkdirAll("torrents", 0755); err != nil {
+		return "", fmt.Errorf("cannot create folder for torrents: %v", err)
+	}
+	fileLink := filepath.Join("torrents", name+".torrent")
+	if err := os.WriteFile(fileLink, data, 0644); err != nil {
+		return "", fmt.Errorf("error writing torrent file: %v", err)
+	}
+	return fileLink, nil
+}
@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/Coolknight/transmission-telegram-bot/sorter"
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/hekmon/transmissionrpc"
+)
+
+// HandleSort handles the /sort <id> [dry] command, placing the videos of a finished download in
+// the media library. With dry nothing is changed, the bot only tells where the files would go
+func (b *Bot) HandleSort(update tgbotapi.Update, client *transmission.Client) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(strings.ToLower(update.Message.CommandArguments()))
+	dryRun := false
+	if len(args) == 2 && (args[1] == "dry" || args[1] == "dry-run") {
+		dryRun = true
+		args = args[:1]
+	}
+	torrentIDs, err := parseTorrentIDs(args)
+	if err != nil || len(torrentIDs) != 1 {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, "Usage: /sort <id> [dry]"))
+		return
+	}
+
+	if b.library.TVDir == "" && b.library.MoviesDir == "" {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, "No media library is configured."))
+		return
+	}
+
+	torrent, err := client.GetTorrentDetails(torrentIDs[0])
+	if err != nil {
+		log.Printf("Error getting torrent %d: %v", torrentIDs[0], err)
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Cannot get torrent #%d: %v", torrentIDs[0], err)))
+		return
+	}
+	if torrent.PercentDone == nil || *torrent.PercentDone < 1.0 {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Torrent #%d has not finished downloading.", torrentIDs[0])))
+		return
+	}
+
+	if !b.sortDownload(chatID, torrent, nil, dryRun) {
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("No videos to sort in torrent #%d.", torrentIDs[0])))
+	}
+}
+
+// sortDownload places the videos of a finished download, along with the extra files given, in
+// the media library and reports where they went. Nothing is reported to a zero chat, nor when
+// the download has no videos, which the return value tells
+func (b *Bot) sortDownload(chatID int64, torrent *transmissionrpc.Torrent, extra []string, dryRun bool) bool {
+	if torrent.Name == nil || torrent.DownloadDir == nil {
+		return false
+	}
+
+	files := append([]string{}, extra...)
+	for i, file := range torrent.Files {
+		// The files left unchecked in the checklist were never downloaded
+		if i < len(torrent.FileStats) && !torrent.FileStats[i].Wanted {
+			continue
+		}
+		files = append(files, filepath.Join(*torrent.DownloadDir, filepath.FromSlash(file.Name)))
+	}
+
+	moves, skipped := sorter.Plan(*torrent.Name, files, b.library)
+	if len(moves) == 0 && len(skipped) == 0 {
+		return false
+	}
+
+	var sb strings.Builder
+	if dryRun {
+		fmt.Fprintf(&sb, "Dry run for %s, nothing has been changed:\n", *torrent.Name)
+	} else {
+		fmt.Fprintf(&sb, "Sorted %s:\n", *torrent.Name)
+	}
+
+	for _, move := range moves {
+		if dryRun {
+			fmt.Fprintf(&sb, "%s → %s\n", filepath.Base(move.Source), move.Target)
+			continue
+		}
+		if err := sorter.Apply(move, b.library); err != nil {
+			log.Printf("Error sorting %s: %v", move.Source, err)
+			fmt.Fprintf(&sb, "❌ %s: %v\n", filepath.Base(move.Source), err)
+			continue
+		}
+		log.Printf("Sorted %s to %s", move.Source, move.Target)
+		fmt.Fprintf(&sb, "✅ %s\n", move.Target)
+	}
+	for _, file := range skipped {
+		fmt.Fprintf(&sb, "Skipped %s, it could not be matched to the library\n", filepath.Base(file))
+	}
+
+	if chatID == 0 {
+		return true
+	}
+	if _, err := b.BotAPI.Send(tgbotapi.NewMessage(chatID, sb.String())); err != nil {
+		log.Println("Error sending sort results:", err)
+	}
+	return true
+}
@@ -0,0 +1,331 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/hekmon/cunits/v2"
+)
+
+// speedUsage explains the /speed subcommands
+const speedUsage = "Usage: /speed [down|up <KB/s|off>] [turtle [on|off]] [alt <down KB/s> <up KB/s>]"
+
+// scheduleUsage explains the /schedule arguments
+const scheduleUsage = "Usage: /schedule [HH:MM-HH:MM [all|weekdays|weekend|mon,tue,...]] [off]"
+
+// scheduleDays maps the day names accepted by /schedule to Transmission's day bits, in week order
+var scheduleDays = []struct {
+	name string
+	bit  int64
+}{
+	{"mon", transmission.Monday},
+	{"tue", transmission.Tuesday},
+	{"wed", transmission.Wednesday},
+	{"thu", transmission.Thursday},
+	{"fri", transmission.Friday},
+	{"sat", transmission.Saturday},
+	{"sun", transmission.Sunday},
+}
+
+// HandleSpeed handles the /speed command, showing or changing the session speed limits
+func (b *Bot) HandleSpeed(update tgbotapi.Update, client *transmission.Client) {
+	chatID := update.Message.Chat.ID
+	args := strings.Fields(strings.ToLower(update.Message.CommandArguments()))
+
+	if len(args) > 0 {
+		if err := changeSpeed(client, args); err != nil {
+			b.BotAPI.Send(tgbotapi.NewMessage(chatID, err.Error()))
+			return
+		}
+		log.Printf("Speed settings changed: %s", strings.Join(args, " "))
+	}
+
+	text, keyboard, err := renderSpeed(client)
+	if err != nil {
+		log.Println("Error getting speed settings:", err)
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Cannot get the speed settings: %v", err)))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending speed settings:", err)
+	}
+}
+
+// changeSpeed applies a /speed subcommand, the returned errors are meant for the user
+func changeSpeed(client *transmission.Client, args []string) error {
+	var err error
+	switch args[0] {
+	case "down", "up":
+		if len(args) != 2 {
+			return errors.New(speedUsage)
+		}
+		limit, ok := parseLimit(args[1])
+		if !ok {
+			return fmt.Errorf("%q is not a speed in KB/s nor off", args[1])
+		}
+		if args[0] == "down" {
+			err = client.SetDownloadLimit(limit)
+		} else {
+			err = client.SetUploadLimit(limit)
+		}
+	case "turtle":
+		enabled := true
+		if len(args) == 2 {
+			switch args[1] {
+			case "on":
+			case "off":
+				enabled = false
+			default:
+				return errors.New(speedUsage)
+			}
+		} else if len(args) != 1 {
+			return errors.New(speedUsage)
+		}
+		err = client.SetAltSpeed(enabled)
+	case "alt":
+		if len(args) != 3 {
+			return errors.New(speedUsage)
+		}
+		down, errDown := strconv.ParseInt(args[1], 10, 64)
+		up, errUp := strconv.ParseInt(args[2], 10, 64)
+		if errDown != nil || errUp != nil || down < 0 || up < 0 {
+			return errors.New("The alt-speed limits must be two speeds in KB/s")
+		}
+		err = client.SetAltSpeedLimits(down, up)
+	default:
+		return errors.New(speedUsage)
+	}
+
+	if err != nil {
+		log.Println("Error changing speed settings:", err)
+		return fmt.Errorf("Transmission refused the change: %v", err)
+	}
+	return nil
+}
+
+// parseLimit reads a non negative limit such as a speed in KB/s, "off" or 0 mean unlimited
+func parseLimit(value string) (int64, bool) {
+	if value == "off" {
+		return 0, true
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 0 {
+		return 0, false
+	}
+	return limit, true
+}
+
+// HandleSpeedButton handles the speed:turtle button, which toggles alt-speed mode
+func (b *Bot) HandleSpeedButton(update tgbotapi.Update, client *transmission.Client) {
+	query := update.CallbackQuery
+	notice := ""
+	defer func() {
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, notice))
+	}()
+
+	if query.Data != "speed:turtle" {
+		log.Printf("Malformed speed callback %q", query.Data)
+		return
+	}
+
+	settings, err := client.GetSpeedSettings()
+	if err == nil {
+		err = client.SetAltSpeed(!settings.AltEnabled)
+	}
+	if err != nil {
+		log.Println("Error toggling alt-speed mode:", err)
+		notice = fmt.Sprintf("Cannot toggle turtle mode: %v", err)
+		return
+	}
+
+	text, keyboard, err := renderSpeed(client)
+	if err != nil {
+		log.Println("Error getting speed settings:", err)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.BotAPI.Send(edit); err != nil {
+		log.Println("Error updating speed settings:", err)
+	}
+}
+
+// renderSpeed builds the text and the turtle toggle of the speed settings
+func renderSpeed(client *transmission.Client) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	settings, err := client.GetSpeedSettings()
+	if err != nil {
+		return "", nil, err
+	}
+
+	turtle := "off"
+	button := "🐢 Turtle on"
+	if settings.AltEnabled {
+		turtle = "on"
+		button = "🐇 Turtle off"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Download: %s/s, limit %s\n", formatBytes(settings.DownloadRate), formatLimit(settings.DownloadLimit, settings.DownloadLimited))
+	fmt.Fprintf(&sb, "Upload: %s/s, limit %s\n", formatBytes(settings.UploadRate), formatLimit(settings.UploadLimit, settings.UploadLimited))
+	fmt.Fprintf(&sb, "Turtle mode: %s (%d KB/s down, %d KB/s up)", turtle, settings.AltDownloadLimit, settings.AltUploadLimit)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(button, "speed:turtle"),
+	))
+	return sb.String(), &keyboard, nil
+}
+
+// formatBytes renders a byte count in human units
+func formatBytes(bytes int64) string {
+	return cunits.ImportInByte(float64(bytes)).GetHumanSizeRepresentation()
+}
+
+// formatLimit renders a session speed limit
+func formatLimit(limit int64, enabled bool) string {
+	if !enabled {
+		return "none"
+	}
+	return fmt.Sprintf("%d KB/s", limit)
+}
+
+// HandleSchedule handles the /schedule command, showing or changing the alt-speed time window
+func (b *Bot) HandleSchedule(update tgbotapi.Update, client *transmission.Client) {
+	chatID := update.Message.Chat.ID
+	args := strings.Fields(strings.ToLower(update.Message.CommandArguments()))
+
+	if len(args) > 0 {
+		schedule, err := parseSchedule(args)
+		if err != nil {
+			b.BotAPI.Send(tgbotapi.NewMessage(chatID, err.Error()))
+			return
+		}
+		if err := client.SetAltSpeedSchedule(schedule); err != nil {
+			log.Println("Error changing alt-speed schedule:", err)
+			b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Transmission refused the schedule: %v", err)))
+			return
+		}
+		log.Printf("Alt-speed schedule changed: %s", strings.Join(args, " "))
+	}
+
+	schedule, err := client.GetAltSpeedSchedule()
+	if err != nil {
+		log.Println("Error getting alt-speed schedule:", err)
+		b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Cannot get the schedule: %v", err)))
+		return
+	}
+
+	text := "Turtle mode schedule: off"
+	if schedule.Enabled {
+		text = fmt.Sprintf("Turtle mode schedule: %s-%s, %s", formatMinutes(schedule.Begin), formatMinutes(schedule.End), formatDays(schedule.Days))
+	}
+	b.BotAPI.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+// parseSchedule reads the /schedule arguments, the days default to every day
+func parseSchedule(args []string) (transmission.AltSpeedSchedule, error) {
+	if len(args) == 1 && args[0] == "off" {
+		return transmission.AltSpeedSchedule{}, nil
+	}
+	if len(args) > 2 {
+		return transmission.AltSpeedSchedule{}, errors.New(scheduleUsage)
+	}
+
+	times := strings.Split(args[0], "-")
+	if len(times) != 2 {
+		return transmission.AltSpeedSchedule{}, errors.New(scheduleUsage)
+	}
+	begin, okBegin := parseMinutes(times[0])
+	end, okEnd := parseMinutes(times[1])
+	if !okBegin || !okEnd {
+		return transmission.AltSpeedSchedule{}, fmt.Errorf("%q is not a HH:MM-HH:MM window", args[0])
+	}
+
+	days := transmission.AllDays
+	if len(args) == 2 {
+		var ok bool
+		if days, ok = parseDays(args[1]); !ok {
+			return transmission.AltSpeedSchedule{}, fmt.Errorf("%q are not days, use all, weekdays, weekend or names such as mon,tue", args[1])
+		}
+	}
+
+	return transmission.AltSpeedSchedule{Enabled: true, Begin: begin, End: end, Days: days}, nil
+}
+
+// parseMinutes reads a HH:MM time as minutes after midnight
+func parseMinutes(value string) (int64, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	hours, errHours := strconv.ParseInt(parts[0], 10, 64)
+	minutes, errMinutes := strconv.ParseInt(parts[1], 10, 64)
+	if errHours != nil || errMinutes != nil || hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+		return 0, false
+	}
+	return hours*60 + minutes, true
+}
+
+// parseDays reads all, weekdays, weekend or a comma separated list of day names
+func parseDays(value string) (int64, bool) {
+	switch value {
+	case "all":
+		return transmission.AllDays, true
+	case "weekdays":
+		return transmission.Weekdays, true
+	case "weekend":
+		return transmission.Weekend, true
+	}
+
+	var days int64
+	for _, name := range strings.Split(value, ",") {
+		found := false
+		for _, day := range scheduleDays {
+			if day.name == name {
+				days |= day.bit
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return days, true
+}
+
+// formatMinutes renders minutes after midnight as HH:MM
+func formatMinutes(minutes int64) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// formatDays renders the days of the schedule
+func formatDays(days int64) string {
+	switch days {
+	case transmission.AllDays:
+		return "every day"
+	case transmission.Weekdays:
+		return "weekdays"
+	case transmission.Weekend:
+		return "weekend"
+	}
+
+	var names []string
+	for _, day := range scheduleDays {
+		if days&day.bit != 0 {
+			names = append(names, day.name)
+		}
+	}
+	if len(names) == 0 {
+		return "no days"
+	}
+	return strings.Join(names, ",")
+}
@@ -11,29 +11,177 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Coolknight/transmission-telegram-bot/dockerhandler"
+	"github.com/Coolknight/transmission-telegram-bot/config"
+	"github.com/Coolknight/transmission-telegram-bot/feeds"
 	"github.com/Coolknight/transmission-telegram-bot/screentime"
 	"github.com/Coolknight/transmission-telegram-bot/transmission"
 	"github.com/Coolknight/transmission-telegram-bot/yamlhandler"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
+// maxTorrentFileSize is the largest document accepted as a torrent file
+const maxTorrentFileSize = 10 << 20
+
 // Bot struct holds the Telegram bot
 type Bot struct {
-	BotAPI *tgbotapi.BotAPI
+	BotAPI        *tgbotapi.BotAPI
+	conversations *conversationManager
+	auth          *authorizer
+	announceChats []config.AnnounceChat
+	downloads     config.Downloads
+	fileRules     *transmission.FileRules
+	hooks         []config.Hook
+	extract       config.Extract
+	library       config.Library
+	diskGuard     config.DiskGuard
+	indexers      []config.Indexer
+	searches      *searchCache
+	feedPoller    *feeds.Poller
+	feedWatcher   *transmission.Watcher
+}
+
+// command binds a command handler to the roles allowed to run it
+type command struct {
+	roles   []string
+	handler func(update tgbotapi.Update)
 }
 
 // NewBot initializes a new Telegram bot
-func NewBot(token string) (*Bot, error) {
-	botAPI, err := tgbotapi.NewBotAPI(token)
+func NewBot(cfg *config.Config) (*Bot, error) {
+	botAPI, err := tgbotapi.NewBotAPI(cfg.Telegram.BotToken)
 	if err != nil {
 		return nil, err
 	}
-	return &Bot{BotAPI: botAPI}, nil
+	fileRules, err := transmission.LoadFileRules("config/file_rules.yaml")
+	if err != nil {
+		log.Printf("Error loading file rules, starting without them: %v", err)
+	}
+
+	return &Bot{
+		BotAPI:        botAPI,
+		conversations: newConversationManager(conversationTimeout),
+		auth:          newAuthorizer(cfg.Telegram),
+		announceChats: announceChats(cfg.Telegram),
+		downloads:     cfg.Downloads,
+		fileRules:     fileRules,
+		hooks:         cfg.Hooks,
+		extract:       cfg.Extract,
+		library:       cfg.Library,
+		diskGuard:     cfg.DiskGuard,
+		indexers:      cfg.Indexers,
+		searches:      newSearchCache(),
+	}, nil
+}
+
+// commands returns the supported commands indexed by name
+func (b *Bot) commands(transmission *transmission.Client, watcher *transmission.Watcher) map[string]command {
+	commands := map[string]command{
+		"torrent": {adults, func(update tgbotapi.Update) {
+			b.converse(update.Message, func(c *conversation) error {
+				return b.HandleTorrentCommand(c, transmission, watcher)
+			})
+		}},
+		"magnet": {adults, func(update tgbotapi.Update) {
+			b.converse(update.Message, func(c *conversation) error {
+				return b.HandleMagnetLink(c, transmission, watcher, update.Message.CommandArguments())
+			})
+		}},
+		"rss": {adminOnly, func(update tgbotapi.Update) {
+			b.HandleRSS(update, transmission)
+		}},
+		"screen": {everyone, b.HandleScreentime},
+		"scan":   {adults, b.HandleScanner},
+		"list": {everyone, func(update tgbotapi.Update) {
+			b.HandleList(update, transmission)
+		}},
+		"files": {adults, func(update tgbotapi.Update) {
+			b.HandleFiles(update, transmission)
+		}},
+		"search": {adults, b.HandleSearch},
+		"sort": {adults, func(update tgbotapi.Update) {
+			b.HandleSort(update, transmission)
+		}},
+		"queue": {adults, func(update tgbotapi.Update) {
+			b.HandleQueue(update, transmission)
+		}},
+		"priority": {adults, func(update tgbotapi.Update) {
+			b.HandlePriority(update, transmission)
+		}},
+		"speed": {adults, func(update tgbotapi.Update) {
+			b.HandleSpeed(update, transmission)
+		}},
+		"schedule": {adults, func(update tgbotapi.Update) {
+			b.HandleSchedule(update, transmission)
+		}},
+		"help": {everyone, b.HandleHelpCommand},
+	}
+
+	// The torrent lifecycle commands share the same handler
+	for _, action := range []string{"pause", "resume", "remove", "verify", "reannounce"} {
+		action := action
+		commands[action] = command{adults, func(update tgbotapi.Update) {
+			b.HandleTorrentAction(update, transmission, action)
+		}}
+	}
+
+	return commands
+}
+
+// callbacks returns the inline button handlers indexed by the prefix of their data
+func (b *Bot) callbacks(transmission *transmission.Client, watcher *transmission.Watcher) map[string]command {
+	return map[string]command{
+		"list": {everyone, func(update tgbotapi.Update) {
+			b.HandleListPage(update, transmission)
+		}},
+		"torrent": {adults, func(update tgbotapi.Update) {
+			b.HandleTorrentButton(update, transmission)
+		}},
+		"files": {adults, func(update tgbotapi.Update) {
+			b.HandleFilesButton(update, transmission)
+		}},
+		"speed": {adults, func(update tgbotapi.Update) {
+			b.HandleSpeedButton(update, transmission)
+		}},
+		"search": {adults, func(update tgbotapi.Update) {
+			b.HandleSearchButton(update, transmission, watcher)
+		}},
+		"rss": {adminOnly, func(update tgbotapi.Update) {
+			b.HandleRSSButton(update, transmission)
+		}},
+	}
+}
+
+// handleCallback routes an inline button press to the handler registered for its data prefix
+func (b *Bot) handleCallback(update tgbotapi.Update, callbacks map[string]command) {
+	query := update.CallbackQuery
+	if query.Message == nil {
+		return
+	}
+
+	prefix := strings.SplitN(query.Data, ":", 2)[0]
+
+	// Answers to a conversation only count from the user it is talking to
+	if prefix == "conv" {
+		if !b.conversations.dispatch(keyForCallback(query), update) {
+			b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "This question is not for you or has expired."))
+		}
+		return
+	}
+
+	cb, ok := callbacks[prefix]
+	if !ok {
+		log.Printf("unknown %s callback\n", query.Data)
+		b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	if b.authorize(update, "button "+prefix, cb.roles) {
+		cb.handler(update)
+	}
 }
 
 // Start updates handler for the bot
-func (b *Bot) Start(transmission *transmission.Client) {
+func (b *Bot) Start(transmission *transmission.Client, watcher *transmission.Watcher) {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
@@ -47,133 +195,231 @@ func (b *Bot) Start(transmission *transmission.Client) {
 	time.Sleep(time.Millisecond * 500)
 	updates.Clear()
 
+	commands := b.commands(transmission, watcher)
+	callbacks := b.callbacks(transmission, watcher)
+
 	log.Println("Bot ready.")
 
 	for update := range updates {
+		if update.CallbackQuery != nil {
+			b.handleCallback(update, callbacks)
+			continue
+		}
+
 		if update.Message == nil {
 			continue
 		}
 
+		// /cancel always wins, any other command or input is handed to the
+		// sender's pending conversation if there is one
+		if update.Message.Command() == "cancel" {
+			b.HandleCancel(update)
+			continue
+		}
+		if !update.Message.IsCommand() && b.conversations.dispatch(keyForMessage(update.Message), update) {
+			continue
+		}
+
 		if update.Message.Document != nil {
 			log.Println("Received a torrent file")
-			b.HandleTorrent(updates, update, transmission)
-		} else {
+			if b.authorize(update, "torrent upload", adults) {
+				b.converse(update.Message, func(c *conversation) error {
+					return b.HandleTorrent(c, update, transmission, watcher)
+				})
+			}
+		} else if update.Message.IsCommand() {
 			log.Printf("Received the following command: %s\n", update.Message.Text)
-			command := strings.Fields(update.Message.Text)[0]
-			switch command {
-			case "/torrent":
-				b.HandleTorrentCommand(updates, update.Message.Chat.ID, transmission)
-			case "/magnet":
-				b.HandleMagnetLink(updates, update.Message.Chat.ID, transmission)
-			case "/rss":
-				b.HandleRSSAdition(updates, update.Message.Chat.ID)
-			case "/screen":
-				b.HandleScreentime(update)
-			case "/scan":
-				b.HandleScanner(update)
-			case "/help":
-				b.HandleHelpCommand(update)
-			default:
+			cmd, ok := commands[update.Message.Command()]
+			if !ok {
 				log.Printf("unknown %s command\n", update.Message.Text)
+				if b.auth.allowed(update, everyone) {
+					b.HandleDefault(update)
+				}
+				continue
+			}
+			if b.authorize(update, "/"+update.Message.Command(), cmd.roles) {
+				cmd.handler(update)
+			}
+		} else if strings.HasPrefix(update.Message.Text, "magnet:?") {
+			// A pasted magnet link works like /magnet <link> [preset]
+			log.Println("Received a magnet link")
+			if b.authorize(update, "magnet link", adults) {
+				b.converse(update.Message, func(c *conversation) error {
+					return b.HandleMagnetLink(c, transmission, watcher, update.Message.Text)
+				})
+			}
+		} else {
+			log.Printf("Received unexpected input: %s\n", update.Message.Text)
+			if b.auth.allowed(update, everyone) {
 				b.HandleDefault(update)
 			}
 		}
 	}
 }
 
-// HandleTorrent handles the process once a torrent file has been uploaded
-func (b *Bot) HandleTorrent(updates <-chan tgbotapi.Update, update tgbotapi.Update, transmission *transmission.Client) {
+// HandleTorrent handles the process once a torrent file has been uploaded, the document caption
+// can name the destination preset or path
+func (b *Bot) HandleTorrent(c *conversation, update tgbotapi.Update, transmission *transmission.Client, watcher *transmission.Watcher) error {
+	// Don't bother downloading anything that cannot be a torrent file
+	if update.Message.Document.FileSize > maxTorrentFileSize {
+		msg := tgbotapi.NewMessage(c.key.ChatID, "That file is too big to be a torrent file.")
+		b.BotAPI.Send(msg)
+		return nil
+	}
+
 	// Get the torrent from the message
 	file, err := b.BotAPI.GetFile(tgbotapi.FileConfig{FileID: update.Message.Document.FileID})
 	if err != nil {
-		log.Println("Error getting file link:", err)
-		return
+		return fmt.Errorf("error getting file link: %v", err)
 	}
 
 	fileLink, err := getTorrent(b, update.Message.Document.FileID, file)
 	if err != nil {
-		log.Printf("Error getting torrent, aborting: %v", err)
-		return
+		return fmt.Errorf("error getting torrent, aborting: %v", err)
 	}
 
-	handleDownload(b, updates, update.Message.Chat.ID, transmission, fileLink)
+	return handleDownload(b, c, transmission, watcher, fileLink, true, update.Message.Caption)
 }
 
 // HandleTorrentCommand handles /torrent command which is ask for the torrent and then handle it like a direct upload
-func (b *Bot) HandleTorrentCommand(updates <-chan tgbotapi.Update, chatID int64, transmission *transmission.Client) {
-	requestMessage := "Please send the torrent file:"
-
-	msg := tgbotapi.NewMessage(chatID, requestMessage)
-	b.BotAPI.Send(msg)
-
-	// Listen for the user's input for the magnet link
-	for update := range updates {
-		if update.Message == nil {
-			continue
-		}
-
-		if update.Message.Document != nil {
-			b.HandleTorrent(updates, update, transmission)
-		}
-		break
+func (b *Bot) HandleTorrentCommand(c *conversation, transmission *transmission.Client, watcher *transmission.Watcher) error {
+	// Listen for the user's input for the torrent file
+	update, err := b.ask(c, "torrent file", "Please send the torrent file:", nil)
+	if err != nil {
+		return err
 	}
-}
 
-// HandleMagnetLink handles the /magnet command
-func (b *Bot) HandleMagnetLink(updates <-chan tgbotapi.Update, chatID int64, transmission *transmission.Client) {
-	var fileLink string
+	if update.Message.Document == nil {
+		msg := tgbotapi.NewMessage(c.key.ChatID, "That is not a torrent file, aborting.")
+		b.BotAPI.Send(msg)
+		return nil
+	}
 
-	requestMessage := "Please enter the magnet link:"
+	return b.HandleTorrent(c, update, transmission, watcher)
+}
 
-	msg := tgbotapi.NewMessage(chatID, requestMessage)
-	b.BotAPI.Send(msg)
+// HandleMagnetLink handles the /magnet [<link> [<preset or path>]] command, asking for whatever is missing
+func (b *Bot) HandleMagnetLink(c *conversation, transmission *transmission.Client, watcher *transmission.Watcher, args string) error {
+	var fileLink, destination string
+	if fields := strings.Fields(args); len(fields) > 0 {
+		fileLink = fields[0]
+		destination = strings.Join(fields[1:], " ")
+	}
 
 	// Listen for the user's input for the magnet link
-	for update := range updates {
-		if update.Message == nil {
-			continue
+	if fileLink == "" {
+		var err error
+		fileLink, err = b.askText(c, "magnet link", "Please enter the magnet link:")
+		if err != nil {
+			return err
 		}
-
-		fileLink = update.Message.Text
-		break
 	}
 
-	handleDownload(b, updates, chatID, transmission, fileLink)
+	return handleDownload(b, c, transmission, watcher, fileLink, false, destination)
 }
 
-// handleDownload handles the common logic for getting the download path and starting the actual download
-func handleDownload(b *Bot, updates <-chan tgbotapi.Update, chatID int64, transmission *transmission.Client, fileLink string) {
+// handleDownload handles the common logic for getting the download path and starting the actual download.
+// fileLink is a magnet link or, when saved is set, a torrent file the bot saved under torrents/. Anything
+// else is user text that must never be read or deleted as a path on the host.
+// The destination given along with the torrent is used when valid, otherwise the user is asked for one
+func handleDownload(b *Bot, c *conversation, transmission *transmission.Client, watcher *transmission.Watcher, fileLink string, saved bool, destination string) error {
+	if !saved && !strings.HasPrefix(fileLink, "magnet:") {
+		log.Printf("Rejected torrent %q: not a magnet link", fileLink)
+		msg := tgbotapi.NewMessage(c.key.ChatID, "That is not a magnet link, it has to start with magnet:")
+		b.BotAPI.Send(msg)
+		return nil
+	}
+	// The saved file is only needed until Transmission got its content, whatever happens next
+	if saved {
+		defer os.Remove(fileLink)
+	}
+
+	// Check the torrent locally so the user hears about anything invalid
+	torrent, err := parseTorrent(fileLink)
+	if err != nil {
+		log.Printf("Rejected torrent %s: %v", fileLink, err)
+		msg := tgbotapi.NewMessage(c.key.ChatID, fmt.Sprintf("Invalid torrent: %v", err))
+		b.BotAPI.Send(msg)
+		return nil
+	}
+	summary := formatMetainfo(torrent)
+
+	// Transmission would silently accept a duplicate, which would be reported as started,
+	// so look for it first and don't go on without knowing
+	existing, err := transmission.FindTorrent(torrent.Hash())
+	if err != nil {
+		log.Printf("Error looking for duplicates of %s: %v", torrent.Hash(), err)
+		msg := tgbotapi.NewMessage(c.key.ChatID, fmt.Sprintf("Cannot check whether Transmission already has this torrent, try again later: %v", err))
+		b.BotAPI.Send(msg)
+		return nil
+	}
+	if existing != nil {
+		return b.handleDuplicate(c, transmission, existing)
+	}
+
 	var downloadPath string
 
-	// Ask for the download path
-	msg := tgbotapi.NewMessage(chatID, "Enter the download path:")
-	b.BotAPI.Send(msg)
+	if destination = strings.TrimSpace(destination); destination != "" {
+		downloadPath, err = b.resolveDownloadPath(transmission, destination)
+		if err != nil {
+			log.Printf("Rejected download path: %v", err)
+			msg := tgbotapi.NewMessage(c.key.ChatID, fmt.Sprintf("Invalid download path: %v", err))
+			b.BotAPI.Send(msg)
+		}
+	}
 
-	// Listen for the user's input for the download path
-	for update := range updates {
-		if update.Message == nil {
-			continue
+	// Ask for the download path
+	if downloadPath == "" {
+		downloadPath, err = b.askDownloadPath(c, transmission, summary)
+		if err != nil {
+			return err
 		}
+	}
 
-		// Extract the download path
-		downloadPath = update.Message.Text
-		break
+	paused, ok := b.checkDiskSpace(c.key.ChatID, transmission, downloadPath, torrent.TotalSize)
+	if !ok {
+		return nil
 	}
 
 	// Start the download using the provided file/link and download path via the Transmission client
-	torrentID, err := transmission.StartDownload(fileLink, downloadPath)
+	torrentID, duplicate, err := transmission.StartDownload(fileLink, downloadPath, paused)
 	if err != nil {
 		log.Println("Error starting download:", err)
-		return
+		msg := tgbotapi.NewMessage(c.key.ChatID, fmt.Sprintf("Transmission refused the torrent: %v", err))
+		b.BotAPI.Send(msg)
+		return nil
+	}
+	if duplicate {
+		// Added by someone else while the user was picking the download path
+		log.Printf("Torrent %d was added meanwhile", torrentID)
+		msg := tgbotapi.NewMessage(c.key.ChatID, fmt.Sprintf("This torrent was added to Transmission meanwhile as #%d, nothing else to do.", torrentID))
+		b.BotAPI.Send(msg)
+		return nil
 	}
 
 	// Notify the user that the download has started
 	log.Println("Download started")
-	startMsg := tgbotapi.NewMessage(chatID, "Download started!")
+	text := fmt.Sprintf("Download started in %s!\n%s", downloadPath, summary)
+	if torrent.Magnet {
+		text += "\nIf it has several files they will be listed once Transmission has fetched its metadata."
+	}
+	startMsg := tgbotapi.NewMessage(c.key.ChatID, text)
 	b.BotAPI.Send(startMsg)
 
-	// Poll download status every minute until it's completed
-	go b.WaitForDownload(torrentID, chatID, transmission)
+	// Let the watcher tell the user when the download completes
+	watcher.Watch(torrentID, c.key.ChatID)
+
+	// Narrow down what gets downloaded from multi-file torrents. A magnet link has no files until
+	// Transmission fetched its metadata, the watcher tells when that happens
+	if torrent.Magnet {
+		watcher.AwaitMetadata(torrentID)
+		return nil
+	}
+	b.applyFileRules(transmission, torrentID, downloadPath)
+	if torrent.Files > 1 {
+		b.sendFileChecklist(c.key.ChatID, transmission, torrentID)
+	}
+	return nil
 }
 
 // getTorrent handles processing of torrent files and returns the path on disk of the torrent file
@@ -219,87 +465,36 @@ func getTorrent(b *Bot, fileID string, file tgbotapi.File) (string, error) {
 	return fileLink, nil
 }
 
-// WaitForDownload is designed to be launched as a subroutine and wait for the download and inform the user
-func (b *Bot) WaitForDownload(torrentID, chatID int64, transmission *transmission.Client) error {
-	for {
-		time.Sleep(time.Minute)
-
-		// Check if download is complete
-		isComplete, err := transmission.IsDownloadComplete(torrentID)
-		if err != nil {
-			log.Println("Error checking download status:", err)
-			return err
-		}
-
-		if isComplete {
-			// If download is complete, get the torrent name
-			name, err := transmission.GetName(torrentID)
-			if err != nil {
-				log.Println("Error retrieving torrent info:", err)
-				return err
-			}
-
-			// Notify the user about the completed download with the torrent name
-			completedMsg := tgbotapi.NewMessage(chatID, "Download completed: "+name)
-			b.BotAPI.Send(completedMsg)
-			break // Exit the loop when download is complete
-		}
-	}
-	return nil
-}
-
 // HandleRSSAdition handles /rss command, adding the new feed and restarting the docker
-func (b *Bot) HandleRSSAdition(updates <-chan tgbotapi.Update, chatID int64) {
-	// Initialize the variables for file/link and download path
-	var rssUrl, downloadPath string
-
-	// Ask for the rss url
-	msg := tgbotapi.NewMessage(chatID, "Enter the RSS url:")
-	b.BotAPI.Send(msg)
-
-	// Listen for the user's input for the download path
-	for update := range updates {
-		if update.Message == nil {
-			continue
-		}
-		// Extract the download path
-		rssUrl = update.Message.Text
-		break
+func (b *Bot) HandleRSSAdition(c *conversation, transmission *transmission.Client) error {
+	// Ask for the rss url, it is checked and shown to the user before going on
+	rssUrl, err := b.askFeedURL(c, "Enter the RSS url:", -1)
+	if err != nil || rssUrl == "" {
+		return err
 	}
 
 	// Ask for the download path
-	msg = tgbotapi.NewMessage(chatID, "Enter the download path:")
-	b.BotAPI.Send(msg)
-
-	// Listen for the user's input for the download path
-	for update := range updates {
-		if update.Message == nil {
-			continue
-		}
-		// Extract the download path
-		downloadPath = update.Message.Text
-		break
+	downloadPath, err := b.askDownloadPath(c, transmission, "")
+	if err != nil {
+		return err
 	}
 
 	log.Printf("Adding feed to yaml...")
 	// Add the new feed to the config file
 	if err := yamlhandler.AddFeedToYAML(rssUrl, downloadPath); err != nil {
-		log.Println("Error adding feed to yaml: ", err)
-		return
+		return fmt.Errorf("error adding feed to yaml: %v", err)
 	}
 	log.Printf("Done.\n")
 
-	// Restart the docker so it starts watching the new feed
-	log.Printf("Restarting Transmission-rss Docker...")
-	if err := dockerhandler.RestartContainer("transmission-rss"); err != nil {
-		log.Println("error restarting rss docker: ", err)
-		return
+	// Restart the docker, or wake the poller, so the new feed is watched
+	if err := b.reloadFeeds(); err != nil {
+		return err
 	}
-	log.Printf("Done.\n")
 
 	// Tell the user the new feed has been created
-	msg = tgbotapi.NewMessage(chatID, "Feed created!")
+	msg := tgbotapi.NewMessage(c.key.ChatID, "Feed created!")
 	b.BotAPI.Send(msg)
+	return nil
 }
 
 // HandleScreentime handles /screen command
@@ -317,6 +512,11 @@ func (b *Bot) HandleScreentime(update tgbotapi.Update) {
 	kidName := strings.ToLower(words[1])
 	command := words[2]
 
+	// Kids can only check their log
+	if command != "log" && !b.authorize(update, "/screen "+command, adults) {
+		return
+	}
+
 	var msg tgbotapi.MessageConfig
 
 	switch command {
@@ -403,10 +603,21 @@ func (b *Bot) HandleHelpCommand(update tgbotapi.Update) {
 
 	// Create the help message with available commands
 	helpMessage := "Available commands:\n" +
-		"/torrent - Upload a torrent file\n" +
-		"/magnet - Input a magnet link\n" +
-		"/rss - Input a rss feed into transmission-rss" +
-		"/screen - Screentime management for kids" +
+		"/torrent - Upload a torrent file, the caption can name the destination\n" +
+		"/magnet [<link> [<destination>]] - Input a magnet link, pasting one works too\n" +
+		"/search <query> - Look for torrents in the configured indexers\n" +
+		"/list [downloading|seeding|stopped|checking] - Show the torrents\n" +
+		"/pause, /resume, /verify, /reannounce <id...> - Control torrents\n" +
+		"/remove <id...> [data] - Remove torrents, optionally deleting their data\n" +
+		"/files <id> - Choose the files to download and their priority\n" +
+		"/sort <id> [dry] - Sort a finished download into the media library\n" +
+		"/queue [top|up|down|bottom <id...>] [size <n|off>] - Show or reorder the download queue\n" +
+		"/priority <high|normal|low> <id...> - Set the bandwidth priority of torrents\n" +
+		"/speed [down|up <KB/s|off>] [turtle [on|off]] [alt <down> <up>] - Show or limit the speed\n" +
+		"/schedule [HH:MM-HH:MM [days]] [off] - Set when turtle mode turns on\n" +
+		"/rss [add|list|edit <n>|remove <n>] - Manage the RSS feeds\n" +
+		"/screen - Screentime management for kids\n" +
+		"/cancel - Abort the current operation\n" +
 		"/help - Show available commands"
 
 	// Send the help message to the user
@@ -0,0 +1,378 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/hekmon/cunits/v2"
+	"github.com/hekmon/transmissionrpc"
+)
+
+// listPageSize is the number of torrents shown in each page of /list
+const listPageSize = 10
+
+// HandleList handles the /list [all|downloading|seeding|stopped|checking] command
+func (b *Bot) HandleList(update tgbotapi.Update, transmission *transmission.Client) {
+	filter := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+
+	text, keyboard, err := renderTorrentList(transmission, filter, 0)
+	if err != nil {
+		log.Printf("Error listing torrents: %v", err)
+		text = fmt.Sprintf("Cannot list torrents: %v", err)
+	}
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending torrent list:", err)
+	}
+}
+
+// HandleListPage handles the next/prev buttons of /list, their data is list:<filter>:<page>
+func (b *Bot) HandleListPage(update tgbotapi.Update, transmission *transmission.Client) {
+	query := update.CallbackQuery
+	defer b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+
+	parts := strings.SplitN(query.Data, ":", 3)
+	if len(parts) != 3 {
+		log.Printf("Malformed list callback %q", query.Data)
+		return
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil {
+		log.Printf("Malformed list callback %q: %v", query.Data, err)
+		return
+	}
+
+	text, keyboard, err := renderTorrentList(transmission, parts[1], page)
+	if err != nil {
+		log.Printf("Error listing torrents: %v", err)
+		text = fmt.Sprintf("Cannot list torrents: %v", err)
+	}
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.BotAPI.Send(edit); err != nil {
+		log.Println("Error updating torrent list:", err)
+	}
+}
+
+// renderTorrentList builds the text and the navigation keyboard of a page of the torrent list
+func renderTorrentList(transmission *transmission.Client, filter string, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	torrents, err := transmission.ListTorrents(filter)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(torrents) == 0 {
+		return "No torrents found.", nil, nil
+	}
+
+	pages := (len(torrents) + listPageSize - 1) / listPageSize
+	if page < 0 {
+		page = 0
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+
+	title := "Torrents"
+	if filter != "" {
+		title = fmt.Sprintf("Torrents (%s)", filter)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s, page %d/%d\n\n", title, page+1, pages)
+
+	end := (page + 1) * listPageSize
+	if end > len(torrents) {
+		end = len(torrents)
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, torrent := range torrents[page*listPageSize : end] {
+		sb.WriteString(formatTorrent(torrent))
+		sb.WriteString("\n")
+
+		// Each entry gets a button opening its action menu
+		label := fmt.Sprintf("#%d %s", *torrent.ID, truncate(*torrent.Name, 30))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("torrent:menu:%d", *torrent.ID))))
+	}
+
+	// Only show the navigation buttons that lead somewhere
+	var buttons []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("« Prev", fmt.Sprintf("list:%s:%d", filter, page-1)))
+	}
+	if page < pages-1 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("Next »", fmt.Sprintf("list:%s:%d", filter, page+1)))
+	}
+	if len(buttons) > 0 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons...))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return sb.String(), &keyboard, nil
+}
+
+// formatTorrent renders a torrent as a two line entry of the torrent list
+func formatTorrent(torrent *transmissionrpc.Torrent) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "#%d %s\n", *torrent.ID, *torrent.Name)
+	fmt.Fprintf(&sb, "    %s %.1f%%", torrent.Status, *torrent.PercentDone*100)
+	if torrent.SizeWhenDone != nil {
+		fmt.Fprintf(&sb, " of %s", torrent.SizeWhenDone.GetHumanSizeRepresentation())
+	}
+	if torrent.RateDownload != nil && *torrent.RateDownload > 0 {
+		fmt.Fprintf(&sb, ", %s/s", cunits.ImportInByte(float64(*torrent.RateDownload)).GetHumanSizeRepresentation())
+	}
+	if torrent.Eta != nil && *torrent.Eta >= 0 {
+		fmt.Fprintf(&sb, ", ETA %s", formatDuration(time.Duration(*torrent.Eta)*time.Second))
+	}
+	if torrent.QueuePosition != nil {
+		fmt.Fprintf(&sb, ", queue %d", *torrent.QueuePosition+1)
+	}
+	if torrent.BandwidthPriority != nil && *torrent.BandwidthPriority != transmission.PriorityNormal {
+		fmt.Fprintf(&sb, ", %s priority", priorityName(*torrent.BandwidthPriority))
+	}
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// truncate shortens a string to at most n runes, adding an ellipsis when it has been cut
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// formatDuration renders a duration rounded to the most significant units, e.g. 2h5m or 1d3h
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		days := d / (24 * time.Hour)
+		return fmt.Sprintf("%dd%dh", days, (d-days*24*time.Hour)/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", d/time.Hour, (d%time.Hour)/time.Minute)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+// torrentAction is an operation that can be run on a set of torrents, done is the format of
+// the message reporting it, which gets the torrent IDs
+type torrentAction struct {
+	run  func(client *transmission.Client, torrentIDs []int64) error
+	done string
+}
+
+// torrentActions are the operations available through commands and torrent menu buttons,
+// purge removes the downloaded data too and always asks for confirmation first
+var torrentActions = map[string]torrentAction{
+	"pause":      {(*transmission.Client).StopTorrents, "Paused %s."},
+	"resume":     {(*transmission.Client).StartTorrents, "Resumed %s."},
+	"verify":     {(*transmission.Client).VerifyTorrents, "Verification started for %s."},
+	"reannounce": {(*transmission.Client).ReannounceTorrents, "Reannounced %s."},
+	"remove": {func(client *transmission.Client, torrentIDs []int64) error {
+		return client.RemoveTorrents(torrentIDs, false)
+	}, "Removed %s."},
+	"purge": {func(client *transmission.Client, torrentIDs []int64) error {
+		return client.RemoveTorrents(torrentIDs, true)
+	}, "Removed %s along with their data."},
+	"top":    {(*transmission.Client).MoveToQueueTop, "Moved %s to the top of the queue."},
+	"up":     {(*transmission.Client).MoveUpInQueue, "Moved %s up in the queue."},
+	"down":   {(*transmission.Client).MoveDownInQueue, "Moved %s down in the queue."},
+	"bottom": {(*transmission.Client).MoveToQueueBottom, "Moved %s to the bottom of the queue."},
+	"high":   {bandwidthPriority(transmission.PriorityHigh), "Gave %s high priority."},
+	"normal": {bandwidthPriority(transmission.PriorityNormal), "Gave %s normal priority."},
+	"low":    {bandwidthPriority(transmission.PriorityLow), "Gave %s low priority."},
+}
+
+// bandwidthPriority returns an action setting the bandwidth priority of torrents
+func bandwidthPriority(priority int64) func(client *transmission.Client, torrentIDs []int64) error {
+	return func(client *transmission.Client, torrentIDs []int64) error {
+		return client.SetBandwidthPriority(torrentIDs, priority)
+	}
+}
+
+// HandleTorrentAction handles the /pause, /resume, /verify, /reannounce and /remove commands,
+// which take one or more torrent IDs. "/remove <id...> data" deletes the data after confirmation
+func (b *Bot) HandleTorrentAction(update tgbotapi.Update, transmission *transmission.Client, action string) {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if action == "remove" && len(args) > 0 && args[len(args)-1] == "data" {
+		action = "purge"
+		args = args[:len(args)-1]
+	}
+
+	torrentIDs, err := parseTorrentIDs(args)
+	if err != nil || len(torrentIDs) == 0 {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Usage: /%s <id> [<id>...]", update.Message.Command()))
+		b.BotAPI.Send(msg)
+		return
+	}
+
+	if action == "purge" {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Remove %s and delete their data? This cannot be undone.", formatTorrentIDs(torrentIDs)))
+		msg.ReplyMarkup = purgeConfirmationKeyboard(torrentIDs)
+		b.BotAPI.Send(msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, runTorrentAction(transmission, action, torrentIDs))
+	if _, err := b.BotAPI.Send(msg); err != nil {
+		log.Println("Error sending action result:", err)
+	}
+}
+
+// HandleTorrentButton handles the torrent menu buttons, their data is torrent:<action>:<ids>
+func (b *Bot) HandleTorrentButton(update tgbotapi.Update, transmission *transmission.Client) {
+	query := update.CallbackQuery
+	defer b.BotAPI.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+
+	parts := strings.SplitN(query.Data, ":", 3)
+	if len(parts) != 3 {
+		log.Printf("Malformed torrent callback %q", query.Data)
+		return
+	}
+	action := parts[1]
+	torrentIDs, err := parseTorrentIDs(strings.Split(parts[2], ","))
+	if err != nil {
+		log.Printf("Malformed torrent callback %q: %v", query.Data, err)
+		return
+	}
+
+	chatID := query.Message.Chat.ID
+	var edit tgbotapi.EditMessageTextConfig
+
+	switch action {
+	case "menu":
+		// The menu is a new message so the list stays in place
+		torrent, err := transmission.GetTorrent(torrentIDs[0])
+		if err != nil {
+			log.Printf("Error getting torrent %d: %v", torrentIDs[0], err)
+			b.BotAPI.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Cannot get torrent #%d: %v", torrentIDs[0], err)))
+			return
+		}
+		msg := tgbotapi.NewMessage(chatID, formatTorrent(torrent))
+		msg.ReplyMarkup = torrentMenuKeyboard(*torrent.ID)
+		b.BotAPI.Send(msg)
+		return
+	case "askpurge":
+		edit = tgbotapi.NewEditMessageText(chatID, query.Message.MessageID,
+			fmt.Sprintf("Remove %s and delete its data? This cannot be undone.", formatTorrentIDs(torrentIDs)))
+		keyboard := purgeConfirmationKeyboard(torrentIDs)
+		edit.ReplyMarkup = &keyboard
+	case "cancel":
+		edit = tgbotapi.NewEditMessageText(chatID, query.Message.MessageID, "Nothing has been removed.")
+	default:
+		edit = tgbotapi.NewEditMessageText(chatID, query.Message.MessageID, runTorrentAction(transmission, action, torrentIDs))
+	}
+
+	if _, err := b.BotAPI.Send(edit); err != nil {
+		log.Println("Error updating torrent menu:", err)
+	}
+}
+
+// runTorrentAction runs the action on the torrents and returns the message for the user
+func runTorrentAction(transmission *transmission.Client, action string, torrentIDs []int64) string {
+	ta, ok := torrentActions[action]
+	if !ok {
+		log.Printf("unknown torrent action %s", action)
+		return fmt.Sprintf("Unknown action %s.", action)
+	}
+
+	if err := ta.run(transmission, torrentIDs); err != nil {
+		log.Printf("Error running %s on %v: %v", action, torrentIDs, err)
+		return fmt.Sprintf("Cannot %s %s: %v", action, formatTorrentIDs(torrentIDs), err)
+	}
+
+	log.Printf("Torrents %v: %s done", torrentIDs, action)
+	return fmt.Sprintf(ta.done, formatTorrentIDs(torrentIDs))
+}
+
+// torrentMenuKeyboard builds the action buttons of a torrent
+func torrentMenuKeyboard(torrentID int64) tgbotapi.InlineKeyboardMarkup {
+	data := func(action string) string {
+		return fmt.Sprintf("torrent:%s:%d", action, torrentID)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Pause", data("pause")),
+			tgbotapi.NewInlineKeyboardButtonData("Resume", data("resume")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Verify", data("verify")),
+			tgbotapi.NewInlineKeyboardButtonData("Reannounce", data("reannounce")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Queue top", data("top")),
+			tgbotapi.NewInlineKeyboardButtonData("Queue bottom", data("bottom")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("High priority", data("high")),
+			tgbotapi.NewInlineKeyboardButtonData("Low priority", data("low")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Remove", data("remove")),
+			tgbotapi.NewInlineKeyboardButtonData("Remove with data", data("askpurge")),
+		),
+	)
+}
+
+// purgeConfirmationKeyboard builds the buttons confirming the removal of torrents and their data
+func purgeConfirmationKeyboard(torrentIDs []int64) tgbotapi.InlineKeyboardMarkup {
+	ids := make([]string, len(torrentIDs))
+	for i, id := range torrentIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	joined := strings.Join(ids, ",")
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Yes, delete the data", "torrent:purge:"+joined),
+			tgbotapi.NewInlineKeyboardButtonData("Cancel", "torrent:cancel:"+joined),
+		),
+	)
+}
+
+// parseTorrentIDs converts a list of arguments into torrent IDs, leading # are allowed
+func parseTorrentIDs(args []string) ([]int64, error) {
+	var torrentIDs []int64
+	for _, arg := range args {
+		id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid torrent ID %q", arg)
+		}
+		torrentIDs = append(torrentIDs, id)
+	}
+	return torrentIDs, nil
+}
+
+// formatTorrentIDs renders torrent IDs for the user, e.g. "torrents #3, #5"
+func formatTorrentIDs(torrentIDs []int64) string {
+	ids := make([]string, len(torrentIDs))
+	for i, id := range torrentIDs {
+		ids[i] = fmt.Sprintf("#%d", id)
+	}
+
+	if len(ids) == 1 {
+		return "torrent " + ids[0]
+	}
+	return "torrents " + strings.Join(ids, ", ")
+}
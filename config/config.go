@@ -28,8 +28,129 @@ type API struct {
 }
 
 type Telegram struct {
-	BotToken string `yaml:"botToken"`
-	ChatID   string `yaml:"chatID"`
+	BotToken     string         `yaml:"botToken"`
+	ChatID       string         `yaml:"chatID"`
+	Users        []TelegramUser `yaml:"users"`
+	Chats        []TelegramChat `yaml:"chats"`
+	ReportDenied bool           `yaml:"reportDenied"`
+	Announce     Announce       `yaml:"announce"`
+}
+
+// Announce configures the notifications about torrents added outside the bot
+type Announce struct {
+	Enabled bool           `yaml:"enabled"`
+	Chats   []AnnounceChat `yaml:"chats"`
+}
+
+// AnnounceChat selects the download directories a chat hears about, none means all of them
+type AnnounceChat struct {
+	ID           int64    `yaml:"id"`
+	DownloadDirs []string `yaml:"downloadDirs"`
+}
+
+// TelegramUser grants a role to a Telegram user, wherever they write from
+type TelegramUser struct {
+	ID   int    `yaml:"id"`
+	Name string `yaml:"name"`
+	Role string `yaml:"role"`
+}
+
+// TelegramChat grants a role to everybody writing in a Telegram chat
+type TelegramChat struct {
+	ID   int64  `yaml:"id"`
+	Role string `yaml:"role"`
+}
+
+// Downloads configures where the bot is allowed to download to
+type Downloads struct {
+	Presets      []Preset `yaml:"presets"`
+	AllowedRoots []string `yaml:"allowedRoots"`
+}
+
+// Preset is a named download destination offered as a button
+type Preset struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+// Seeding holds the seeding policies, the first one matching a torrent applies to it
+type Seeding struct {
+	Policies []SeedingPolicy `yaml:"policies"`
+}
+
+// SeedingPolicy sets the seeding limits of the torrents from some trackers or download presets,
+// and whether they are removed once they reach them. Zero limits keep Transmission's global ones
+type SeedingPolicy struct {
+	Name        string   `yaml:"name"`
+	Trackers    []string `yaml:"trackers"`
+	Presets     []string `yaml:"presets"`
+	Ratio       float64  `yaml:"ratio"`
+	IdleMinutes int64    `yaml:"idleMinutes"`
+	Remove      bool     `yaml:"remove"`
+	DeleteData  bool     `yaml:"deleteData"`
+}
+
+// Watcher configures how downloads are followed, a download without progress for
+// StallMinutes is reported as stalled
+type Watcher struct {
+	StallMinutes int `yaml:"stallMinutes"`
+}
+
+// Hook is run when a download completes, either a local command or an HTTP POST. The command
+// arguments, the URL and the body are templates receiving the torrent's Name, ID, Hash and DownloadDir
+type Hook struct {
+	Name           string            `yaml:"name"`
+	Command        []string          `yaml:"command"`
+	URL            string            `yaml:"url"`
+	Body           string            `yaml:"body"`
+	Headers        map[string]string `yaml:"headers"`
+	DownloadDirs   []string          `yaml:"downloadDirs"`
+	TimeoutSeconds int               `yaml:"timeoutSeconds"`
+}
+
+// Extract configures the extraction of the ZIP and RAR archives found in finished downloads.
+// They are extracted next to the archive, or under Destination in a directory named after the torrent
+type Extract struct {
+	Enabled      bool     `yaml:"enabled"`
+	Destination  string   `yaml:"destination"`
+	DownloadDirs []string `yaml:"downloadDirs"`
+}
+
+// Library configures where finished TV and movie downloads are sorted to. Mode is "hardlink",
+// "copy", or empty to hard link and fall back to copying across filesystems. With Auto set every
+// finished download in DownloadDirs is sorted, otherwise only the ones given to /sort
+type Library struct {
+	TVDir        string   `yaml:"tvDir"`
+	MoviesDir    string   `yaml:"moviesDir"`
+	Mode         string   `yaml:"mode"`
+	Auto         bool     `yaml:"auto"`
+	DownloadDirs []string `yaml:"downloadDirs"`
+}
+
+// DiskGuard keeps downloads from filling the disks. A new torrent has to leave ReserveGB free in
+// its download dir, otherwise it is refused or, when WhenShort is "pause", added paused. Every
+// CheckMinutes the Dirs are checked and all downloads are paused when one has less than MinFreeGB
+type DiskGuard struct {
+	ReserveGB    float64  `yaml:"reserveGB"`
+	WhenShort    string   `yaml:"whenShort"`
+	MinFreeGB    float64  `yaml:"minFreeGB"`
+	CheckMinutes int      `yaml:"checkMinutes"`
+	Dirs         []string `yaml:"dirs"`
+}
+
+// Indexer is a Torznab compatible search endpoint, such as a Jackett or Prowlarr indexer
+type Indexer struct {
+	Name       string `yaml:"name"`
+	URL        string `yaml:"url"`
+	APIKey     string `yaml:"apiKey"`
+	Categories []int  `yaml:"categories"`
+}
+
+// RSS configures the built-in feed poller. With Poll set the feeds of rss/rss.conf are read every
+// IntervalMinutes and their new items added to Transmission, replacing the transmission-rss container
+type RSS struct {
+	Poll            bool `yaml:"poll"`
+	IntervalMinutes int  `yaml:"intervalMinutes"`
 }
 
 type Device struct {
@@ -41,6 +162,15 @@ type Config struct {
 	API          API          `yaml:"api"`
 	Telegram     Telegram     `yaml:"telegram"`
 	Device       Device       `yaml:"device"`
+	Downloads    Downloads    `yaml:"downloads"`
+	Seeding      Seeding      `yaml:"seeding"`
+	Watcher      Watcher      `yaml:"watcher"`
+	Hooks        []Hook       `yaml:"hooks"`
+	Extract      Extract      `yaml:"extract"`
+	Library      Library      `yaml:"library"`
+	DiskGuard    DiskGuard    `yaml:"diskGuard"`
+	Indexers     []Indexer    `yaml:"indexers"`
+	RSS          RSS          `yaml:"rss"`
 }
 
 // ReadConfig loads configuration from a YAML file
@@ -59,6 +189,15 @@ func ReadConfig(filename string) (*Config, error) {
 	if cfg.Transmission.Port == 0 {
 		cfg.Transmission.Port = 9091
 	}
+	if cfg.DiskGuard.CheckMinutes == 0 {
+		cfg.DiskGuard.CheckMinutes = 10
+	}
+	if cfg.Watcher.StallMinutes == 0 {
+		cfg.Watcher.StallMinutes = 30
+	}
+	if cfg.RSS.IntervalMinutes == 0 {
+		cfg.RSS.IntervalMinutes = 10
+	}
 
 	return &cfg, nil
 }
@@ -0,0 +1,216 @@
+package feeds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxFeedSize bounds what is read from a feed
+const maxFeedSize = 10 << 20
+
+// Feed is an RSS 2.0 or Atom feed
+type Feed struct {
+	Title string
+	Items []Item
+}
+
+// Item is an entry of a feed. Link is its magnet link or .torrent URL, empty when it has none
+type Item struct {
+	Title string
+	GUID  string
+	Link  string
+}
+
+// Torrents returns the items with a magnet link or a .torrent URL
+func (f *Feed) Torrents() []Item {
+	var torrents []Item
+	for _, item := range f.Items {
+		if item.Link != "" {
+			torrents = append(torrents, item)
+		}
+	}
+	return torrents
+}
+
+// link is an RSS <enclosure> or an Atom <link>
+type link struct {
+	Href string `xml:"href,attr"`
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// document holds both formats, the root element tells which one was read
+type document struct {
+	XMLName xml.Name
+	// RSS 2.0
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	// Atom
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title      string `xml:"title"`
+	GUID       string `xml:"guid"`
+	Link       string `xml:"link"`
+	Enclosures []link `xml:"enclosure"`
+	// ezRSS and showRSS put the magnet link in <torrent:magnetURI>
+	MagnetURI string `xml:"magnetURI"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []link `xml:"link"`
+}
+
+// Fetch downloads and parses a feed
+func Fetch(feedURL string, timeout time.Duration) (*Feed, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("not an http or https URL")
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(feedURL)
+	if err != nil {
+		// Keep the URL out of the error, private feeds carry a passkey in it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	return Parse(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// Parse reads an RSS 2.0 or Atom feed
+func Parse(r io.Reader) (*Feed, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charsetReader
+	// Feeds often use HTML entities such as &nbsp; without declaring them
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	var doc document
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("not a valid feed: %v", err)
+	}
+
+	var feed Feed
+	switch strings.ToLower(doc.XMLName.Local) {
+	case "rss":
+		feed.Title = strings.TrimSpace(doc.Channel.Title)
+		for _, it := range doc.Channel.Items {
+			item := Item{Title: strings.TrimSpace(it.Title), GUID: strings.TrimSpace(it.GUID), Link: rssLink(it)}
+			if item.GUID == "" {
+				item.GUID = strings.TrimSpace(it.Link)
+			}
+			feed.Items = append(feed.Items, item)
+		}
+	case "feed":
+		feed.Title = strings.TrimSpace(doc.Title)
+		for _, entry := range doc.Entries {
+			item := Item{Title: strings.TrimSpace(entry.Title), GUID: strings.TrimSpace(entry.ID), Link: atomLink(entry)}
+			if item.GUID == "" {
+				item.GUID = item.Link
+			}
+			feed.Items = append(feed.Items, item)
+		}
+	default:
+		return nil, fmt.Errorf("not an RSS or Atom feed, the document is <%s>", doc.XMLName.Local)
+	}
+
+	// Without a GUID the title is the only way left to tell the items apart
+	for i := range feed.Items {
+		if feed.Items[i].GUID == "" {
+			feed.Items[i].GUID = feed.Items[i].Title
+		}
+	}
+	return &feed, nil
+}
+
+// rssLink finds the torrent of an RSS item
+func rssLink(it rssItem) string {
+	var typed []string
+	others := []string{it.MagnetURI, it.Link}
+	for _, enclosure := range it.Enclosures {
+		if enclosure.Type == "application/x-bittorrent" {
+			typed = append(typed, enclosure.URL)
+		} else {
+			others = append(others, enclosure.URL)
+		}
+	}
+	return torrentLink(typed, others)
+}
+
+// atomLink finds the torrent of an Atom entry
+func atomLink(entry atomEntry) string {
+	var typed, others []string
+	for _, l := range entry.Links {
+		if l.Type == "application/x-bittorrent" {
+			typed = append(typed, l.Href)
+		} else {
+			others = append(others, l.Href)
+		}
+	}
+	return torrentLink(typed, others)
+}
+
+// torrentLink prefers a magnet link, then a link typed as a torrent whatever its URL looks like,
+// e.g. download.php?id=, and then a .torrent URL
+func torrentLink(typed, others []string) string {
+	all := append(append([]string{}, typed...), others...)
+	for _, candidate := range all {
+		if candidate = strings.TrimSpace(candidate); strings.HasPrefix(candidate, "magnet:") {
+			return candidate
+		}
+	}
+	for _, candidate := range typed {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			return candidate
+		}
+	}
+	for _, candidate := range others {
+		candidate = strings.TrimSpace(candidate)
+		if u, err := url.Parse(candidate); err == nil && strings.HasSuffix(strings.ToLower(u.Path), ".torrent") {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// charsetReader lets feeds declared as Latin-1 be read, encoding/xml only knows UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "iso8859-1", "latin1", "windows-1252":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		return bytes.NewReader([]byte(string(runes))), nil
+	}
+	return nil, fmt.Errorf("unsupported charset %s", charset)
+}
@@ -0,0 +1,152 @@
+package feeds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const rssFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/">
+  <channel>
+    <title> Show&nbsp;RSS </title>
+    <item>
+      <title>Show S01E01</title>
+      <guid>guid-1</guid>
+      <link>http://example.com/details/1</link>
+      <torrent:magnetURI>magnet:?xt=urn:btih:1</torrent:magnetURI>
+    </item>
+    <item>
+      <title>Show S01E02</title>
+      <guid>guid-2</guid>
+      <enclosure url="http://example.com/download.php?id=2" type="application/x-bittorrent"/>
+    </item>
+    <item>
+      <title>Show S01E03</title>
+      <link>http://example.com/files/3.torrent?passkey=secret</link>
+    </item>
+    <item>
+      <title>Just an article</title>
+      <link>http://example.com/news/4</link>
+    </item>
+  </channel>
+</rss>`
+
+const atomFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Atom feed</title>
+  <entry>
+    <title>Movie (2019)</title>
+    <id>urn:uuid:1</id>
+    <link href="http://example.com/movie"/>
+    <link rel="enclosure" href="http://example.com/get/1" type="application/x-bittorrent"/>
+  </entry>
+  <entry>
+    <title>Other movie</title>
+    <link href="magnet:?xt=urn:btih:2"/>
+  </entry>
+</feed>`
+
+func TestParseRSS(t *testing.T) {
+	feed, err := Parse(strings.NewReader(rssFeed))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if feed.Title != "Show RSS" {
+		t.Errorf("got title %q", feed.Title)
+	}
+
+	want := []Item{
+		{Title: "Show S01E01", GUID: "guid-1", Link: "magnet:?xt=urn:btih:1"},
+		{Title: "Show S01E02", GUID: "guid-2", Link: "http://example.com/download.php?id=2"},
+		{Title: "Show S01E03", GUID: "http://example.com/files/3.torrent?passkey=secret", Link: "http://example.com/files/3.torrent?passkey=secret"},
+		{Title: "Just an article", GUID: "http://example.com/news/4"},
+	}
+	if !reflect.DeepEqual(feed.Items, want) {
+		t.Errorf("got items %+v, want %+v", feed.Items, want)
+	}
+	if torrents := feed.Torrents(); len(torrents) != 3 {
+		t.Errorf("got %d torrents, want the 3 items with a link", len(torrents))
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	feed, err := Parse(strings.NewReader(atomFeed))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if feed.Title != "Atom feed" {
+		t.Errorf("got title %q", feed.Title)
+	}
+
+	want := []Item{
+		{Title: "Movie (2019)", GUID: "urn:uuid:1", Link: "http://example.com/get/1"},
+		{Title: "Other movie", GUID: "magnet:?xt=urn:btih:2", Link: "magnet:?xt=urn:btih:2"},
+	}
+	if !reflect.DeepEqual(feed.Items, want) {
+		t.Errorf("got items %+v, want %+v", feed.Items, want)
+	}
+}
+
+func TestParseLatin1(t *testing.T) {
+	data := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss><channel><title>Pel\xedculas</title></channel></rss>"
+	feed, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if feed.Title != "Películas" {
+		t.Errorf("got title %q, want it decoded from Latin-1", feed.Title)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"html page", "<html><body>Login</body></html>", "not an RSS or Atom feed"},
+		{"not xml", "just text", "not a valid feed"},
+		{"unknown charset", `<?xml version="1.0" encoding="EBCDIC"?><rss></rss>`, "not a valid feed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.data))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(rssFeed))
+	}))
+	defer server.Close()
+
+	feed, err := Fetch(server.URL+"/feed?passkey=secret", 5*time.Second)
+	if err != nil || len(feed.Items) != 4 {
+		t.Fatalf("Fetch = %+v, %v, want the feed", feed, err)
+	}
+
+	if _, err := Fetch(server.URL+"/missing", 5*time.Second); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got error %v, want the bad status", err)
+	}
+	if _, err := Fetch("file:///etc/passwd", 5*time.Second); err == nil {
+		t.Error("expected a non HTTP URL to be refused")
+	}
+
+	// The server is gone, the error must not carry the passkey of the URL
+	server.Close()
+	if _, err := Fetch(server.URL+"/feed?passkey=secret", 5*time.Second); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("got error %v, want one without the passkey", err)
+	}
+}
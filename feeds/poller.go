@@ -0,0 +1,290 @@
+package feeds
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	"github.com/Coolknight/transmission-telegram-bot/yamlhandler"
+	"github.com/hekmon/cunits/v2"
+)
+
+const (
+	// fetchTimeout bounds the time waited for each feed
+	fetchTimeout = time.Minute
+	// maxAttempts is the number of polls an item is tried on before giving up on it
+	maxAttempts = 3
+	// seenRetention is how long an item no longer in its feed is remembered
+	seenRetention = 30 * 24 * time.Hour
+)
+
+// Addition describes an item of a feed added to Transmission, or given up on when Err is set.
+// Paused tells it was added paused because its download dir is short of space
+type Addition struct {
+	Feed      string
+	Title     string
+	TorrentID int64
+	Paused    bool
+	Err       error
+}
+
+// Poller reads the feeds of the transmission-rss configuration and adds their new items to
+// Transmission. The configuration is read again on every poll, so changes need no restart
+type Poller struct {
+	client      *transmission.Client
+	store       *Store
+	diskGuard   config.DiskGuard
+	interval    time.Duration
+	wake        chan struct{}
+	mu          sync.Mutex
+	attempts    map[string]int
+	subscribers []func([]Addition)
+}
+
+// NewPoller creates a poller reading the feeds every interval, the seen items are kept in the store.
+// New items have to leave the reserve of the disk guard free, as the ones added through the bot
+func NewPoller(client *transmission.Client, store *Store, diskGuard config.DiskGuard, interval time.Duration) *Poller {
+	return &Poller{
+		client:    client,
+		store:     store,
+		diskGuard: diskGuard,
+		interval:  interval,
+		wake:      make(chan struct{}, 1),
+		attempts:  make(map[string]int),
+	}
+}
+
+// Subscribe registers a handler called with the items added in each poll, handlers run on the
+// poller goroutine
+func (p *Poller) Subscribe(handler func([]Addition)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers = append(p.subscribers, handler)
+}
+
+// Wake asks for a poll right away, e.g. after the feeds changed
+func (p *Poller) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+		// A poll is already pending
+	}
+}
+
+// Run polls the feeds until the program ends, it is designed to be launched as a goroutine
+func (p *Poller) Run() {
+	for {
+		if err := p.poll(); err != nil {
+			log.Printf("Error polling RSS feeds: %v", err)
+		}
+
+		select {
+		case <-time.After(p.interval):
+		case <-p.wake:
+		}
+	}
+}
+
+// poll checks every enabled feed. The items of a feed polled for the first time are only marked
+// as seen, otherwise adding a feed would download its whole history
+func (p *Poller) poll() error {
+	configured, err := yamlhandler.ListFeeds()
+	if err != nil {
+		return err
+	}
+	seen, err := p.store.Load()
+	if err != nil {
+		return fmt.Errorf("error loading seen items: %v", err)
+	}
+
+	now := time.Now()
+	var additions []Addition
+	kept := make(Seen)
+	for _, feed := range configured {
+		items := seen[feed.URL]
+		if feed.Enabled {
+			var added []Addition
+			items, added, err = p.pollFeed(feed, items, now)
+			if err != nil {
+				log.Printf("Error polling feed %s: %v", feed.URL, err)
+			}
+			additions = append(additions, added...)
+		}
+		// A paused feed keeps its items, so resuming it doesn't bring back old ones
+		if items != nil {
+			kept[feed.URL] = items
+		}
+	}
+
+	// The feeds removed from the configuration are forgotten
+	if err := p.store.Save(kept); err != nil {
+		return fmt.Errorf("error saving seen items: %v", err)
+	}
+
+	if len(additions) > 0 {
+		p.emit(additions)
+	}
+	return nil
+}
+
+// pollFeed adds the new items of a feed matching its filters and returns the updated seen
+// items. A nil items means the feed was never polled, it stays that way until a poll succeeds
+func (p *Poller) pollFeed(feed yamlhandler.Feed, items map[string]time.Time, now time.Time) (map[string]time.Time, []Addition, error) {
+	include, err := compile(feed.Include)
+	if err != nil {
+		return items, nil, err
+	}
+	exclude, err := compile(feed.Exclude)
+	if err != nil {
+		return items, nil, err
+	}
+
+	fetched, err := Fetch(feed.URL, fetchTimeout)
+	if err != nil {
+		return items, nil, err
+	}
+	name := fetched.Title
+	if name == "" {
+		name = feed.URL
+	}
+
+	first := items == nil
+	if first {
+		items = make(map[string]time.Time)
+	}
+
+	var additions []Addition
+	present := make(map[string]bool)
+	for _, item := range fetched.Torrents() {
+		present[item.GUID] = true
+		if _, ok := items[item.GUID]; ok || first {
+			items[item.GUID] = now
+			continue
+		}
+		if !matches(item.Title, include, exclude) {
+			// Not marked as seen, so the item is considered again if the filters change
+			continue
+		}
+
+		key := feed.URL + "\x00" + item.GUID
+		paused, err := p.checkReserve(feed.DownloadPath)
+		var torrentID int64
+		var duplicate bool
+		if err == nil {
+			torrentID, duplicate, err = p.client.StartDownload(item.Link, feed.DownloadPath, paused)
+		}
+		switch {
+		case err != nil:
+			p.attempts[key]++
+			log.Printf("Error adding %q from %s (attempt %d): %v", item.Title, feed.URL, p.attempts[key], err)
+			if p.attempts[key] < maxAttempts {
+				continue
+			}
+			delete(p.attempts, key)
+			additions = append(additions, Addition{Feed: name, Title: item.Title, Err: err})
+		case duplicate:
+			// Added by hand or by another feed, whoever added it already follows it
+			delete(p.attempts, key)
+			log.Printf("%q from %s is already in Transmission as torrent %d", item.Title, feed.URL, torrentID)
+		default:
+			delete(p.attempts, key)
+			log.Printf("Added %q from %s as torrent %d", item.Title, feed.URL, torrentID)
+			additions = append(additions, Addition{Feed: name, Title: item.Title, TorrentID: torrentID, Paused: paused})
+		}
+		items[item.GUID] = now
+	}
+
+	if first {
+		log.Printf("First poll of %s, %d items marked as seen", feed.URL, len(items))
+	}
+
+	// Forget the items that left the feed long ago
+	for guid, lastSeen := range items {
+		if !present[guid] && now.Sub(lastSeen) > seenRetention {
+			delete(items, guid)
+		}
+	}
+	return items, additions, nil
+}
+
+// checkReserve checks the download dir of a feed has the reserve free. The size of an item is
+// only known once Transmission fetched it, so only the reserve itself is checked. When short the
+// item is to be added paused or, unless the disk guard says so, refused with an error so it is
+// tried again on the next polls
+func (p *Poller) checkReserve(downloadPath string) (paused bool, err error) {
+	if p.diskGuard.ReserveGB <= 0 {
+		return false, nil
+	}
+
+	dir := downloadPath
+	if dir == "" {
+		if dir, err = p.client.DefaultDownloadDir(); err != nil {
+			log.Printf("Error getting the download dir, adding the item anyway: %v", err)
+			return false, nil
+		}
+	}
+	free, err := p.client.FreeSpace(dir)
+	if err != nil {
+		log.Printf("Error getting free space of %s, adding the item anyway: %v", dir, err)
+		return false, nil
+	}
+
+	reserve := cunits.ImportInGiB(p.diskGuard.ReserveGB)
+	if free >= reserve {
+		return false, nil
+	}
+	if p.diskGuard.WhenShort == "pause" {
+		return true, nil
+	}
+	return false, fmt.Errorf("not enough space in %s: %s free and %s must stay free", dir,
+		free.GetHumanSizeRepresentation(), reserve.GetHumanSizeRepresentation())
+}
+
+// compile turns the filters of a feed into case insensitive regular expressions
+func compile(patterns yamlhandler.Patterns) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// matches checks a title matches one of the include filters, if any, and none of the exclude ones
+func matches(title string, include, exclude []*regexp.Regexp) bool {
+	title = strings.TrimSpace(title)
+	for _, re := range exclude {
+		if re.MatchString(title) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, re := range include {
+		if re.MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
+
+// emit hands the additions to every subscriber
+func (p *Poller) emit(additions []Addition) {
+	p.mu.Lock()
+	subscribers := append([]func([]Addition){}, p.subscribers...)
+	p.mu.Unlock()
+
+	for _, handler := range subscribers {
+		handler(additions)
+	}
+}
@@ -0,0 +1,49 @@
+package feeds
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Coolknight/transmission-telegram-bot/gobfile"
+)
+
+// Seen holds, for each feed URL, the GUIDs of its items already handled and when each one was
+// last found in the feed
+type Seen map[string]map[string]time.Time
+
+// Store keeps the seen items on disk so they are not added again after a restart
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStore creates a store backed by the given gob file
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load reads the seen items, a missing file means there are none
+func (s *Store) Load() (Seen, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(Seen)
+	err := gobfile.Load(s.path, &seen)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(Seen), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return seen, nil
+}
+
+// Save replaces the stored items
+func (s *Store) Save(seen Seen) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return gobfile.Save(s.path, seen)
+}
@@ -5,7 +5,9 @@ go 1.21.4
 require (
 	github.com/docker/docker v24.0.7+incompatible
 	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible
+	github.com/hekmon/cunits/v2 v2.0.2
 	github.com/hekmon/transmissionrpc v1.1.0
+	github.com/nwaples/rardecode/v2 v2.2.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -17,7 +19,6 @@ require (
 	github.com/docker/go-units v0.5.0 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.1 // indirect
-	github.com/hekmon/cunits/v2 v2.0.2 // indirect
 	github.com/moby/term v0.5.0 // indirect
 	github.com/morikuni/aec v1.0.0 // indirect
 	github.com/opencontainers/go-digest v1.0.0 // indirect
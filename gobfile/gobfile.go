@@ -0,0 +1,39 @@
+package gobfile
+
+import (
+	"encoding/gob"
+	"os"
+)
+
+// Load decodes the content of a gob file into value, the error wraps os.ErrNotExist when the
+// file is missing
+func Load(path string, value interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return gob.NewDecoder(file).Decode(value)
+}
+
+// Save replaces the content of a gob file, the file is written aside and renamed so a crash
+// never leaves it half written
+func Save(path string, value interface{}) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	encoder := gob.NewEncoder(file)
+	if err := encoder.Encode(value); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
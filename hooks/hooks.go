@@ -0,0 +1,178 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+	"github.com/Coolknight/transmission-telegram-bot/transmission"
+)
+
+// defaultTimeout bounds the hooks without a timeout of their own
+const defaultTimeout = time.Minute
+
+// maxOutput is the amount of output kept from each hook, the tail is the interesting part
+const maxOutput = 2000
+
+// funcs escape the variables for where they go, {{json .Name}} writes a JSON string and
+// {{urlquery .Name}} a URL query value, torrent names often hold quotes, & or #
+var funcs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		// The body isn't HTML, & and < are kept as they are
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	},
+	"urlquery": func(value interface{}) string {
+		return url.QueryEscape(fmt.Sprint(value))
+	},
+}
+
+// Torrent holds the variables available to the hook templates, e.g. {{.Name}} or {{.DownloadDir}}
+type Torrent struct {
+	Name        string
+	ID          int64
+	Hash        string
+	DownloadDir string
+}
+
+// Result tells how a hook went, Output is what the command printed or the HTTP response body
+type Result struct {
+	Name     string
+	Err      error
+	Output   string
+	Duration time.Duration
+}
+
+// Run runs in order the hooks that apply to the torrent's download dir and returns their results
+func Run(hooks []config.Hook, torrent Torrent) []Result {
+	var results []Result
+	for _, hook := range hooks {
+		if !transmission.InDownloadDirs(torrent.DownloadDir, hook.DownloadDirs) {
+			continue
+		}
+
+		start := time.Now()
+		output, err := run(hook, torrent)
+		results = append(results, Result{
+			Name:     hook.Name,
+			Err:      err,
+			Output:   tail(strings.TrimSpace(output), maxOutput),
+			Duration: time.Since(start),
+		})
+	}
+	return results
+}
+
+// run runs a single hook within its timeout
+func run(hook config.Hook, torrent Torrent) (string, error) {
+	timeout := defaultTimeout
+	if hook.TimeoutSeconds > 0 {
+		timeout = time.Duration(hook.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var output string
+	var err error
+	switch {
+	case len(hook.Command) > 0:
+		output, err = runCommand(ctx, hook.Command, torrent)
+	case hook.URL != "":
+		output, err = post(ctx, hook, torrent)
+	default:
+		return "", errors.New("hook has neither a command nor a URL")
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("timed out after %s", timeout)
+	}
+	return output, err
+}
+
+// runCommand runs a local command, each argument is a template. There is no shell involved so
+// torrent names cannot inject anything
+func runCommand(ctx context.Context, command []string, torrent Torrent) (string, error) {
+	args := make([]string, len(command))
+	for i, arg := range command {
+		expanded, err := expand(arg, torrent)
+		if err != nil {
+			return "", err
+		}
+		args[i] = expanded
+	}
+
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	return string(output), err
+}
+
+// post sends the templated body to the templated URL
+func post(ctx context.Context, hook config.Hook, torrent Torrent) (string, error) {
+	target, err := expand(hook.URL, torrent)
+	if err != nil {
+		return "", err
+	}
+	body, err := expand(hook.Body, torrent)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	response, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return string(response), fmt.Errorf("server answered %s", resp.Status)
+	}
+	return string(response), nil
+}
+
+// expand fills a template with the torrent variables
+func expand(text string, torrent Torrent) (string, error) {
+	tmpl, err := template.New("hook").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %q: %v", text, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, torrent); err != nil {
+		return "", fmt.Errorf("invalid template %q: %v", text, err)
+	}
+	return buf.String(), nil
+}
+
+// tail keeps the last n bytes of the output, as valid UTF-8 so it can be sent to Telegram
+func tail(output string, n int) string {
+	if len(output) > n {
+		output = "…" + output[len(output)-n:]
+	}
+	return strings.ToValidUTF8(output, "")
+}
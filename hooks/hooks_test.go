@@ -0,0 +1,83 @@
+package hooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+)
+
+// awkwardName needs escaping both in JSON and in a URL
+const awkwardName = `Show "Special" \ A&B?c=d#1 100%`
+
+func TestExpand(t *testing.T) {
+	torrent := Torrent{Name: awkwardName, ID: 7, DownloadDir: "/downloads/tv"}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{{.DownloadDir}}/{{.Name}}", "/downloads/tv/" + awkwardName},
+		{"{{json .Name}}", `"Show \"Special\" \\ A&B?c=d#1 100%"`},
+		{"{{json .ID}}", "7"},
+		{"?name={{urlquery .Name}}", "?name=Show+%22Special%22+%5C+A%26B%3Fc%3Dd%231+100%25"},
+	}
+	for _, test := range tests {
+		got, err := expand(test.text, torrent)
+		if err != nil {
+			t.Errorf("expand(%q): %v", test.text, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("expand(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+
+	if _, err := expand("{{.Missing}}", torrent); err == nil {
+		t.Error("expected an error for an unknown variable")
+	}
+}
+
+func TestRunPostEscapesName(t *testing.T) {
+	var gotName, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotName = r.URL.Query().Get("name")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	hook := config.Hook{
+		Name: "webhook",
+		URL:  server.URL + "/done?name={{urlquery .Name}}",
+		Body: `{"name": {{json .Name}}, "dir": {{json .DownloadDir}}}`,
+	}
+	results := Run([]config.Hook{hook}, Torrent{Name: awkwardName, DownloadDir: "/downloads/tv"})
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("got results %+v, want the hook to succeed", results)
+	}
+
+	if gotName != awkwardName {
+		t.Errorf("got name %q in the URL, want %q", gotName, awkwardName)
+	}
+	var body struct {
+		Name string `json:"name"`
+		Dir  string `json:"dir"`
+	}
+	if err := json.Unmarshal([]byte(gotBody), &body); err != nil {
+		t.Fatalf("body %s is not valid JSON: %v", gotBody, err)
+	}
+	if body.Name != awkwardName || body.Dir != "/downloads/tv" {
+		t.Errorf("got body %+v", body)
+	}
+}
+
+func TestRunSkipsOtherDirs(t *testing.T) {
+	hook := config.Hook{Name: "movies", Command: []string{"true"}, DownloadDirs: []string{"/downloads/movies"}}
+	if results := Run([]config.Hook{hook}, Torrent{Name: "x", DownloadDir: "/downloads/tv"}); len(results) != 0 {
+		t.Errorf("got results %+v, want the hook skipped", results)
+	}
+}
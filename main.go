@@ -2,11 +2,14 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/Coolknight/transmission-telegram-bot/bot"
 	"github.com/Coolknight/transmission-telegram-bot/config"
+	"github.com/Coolknight/transmission-telegram-bot/feeds"
 	"github.com/Coolknight/transmission-telegram-bot/solarman"
 	"github.com/Coolknight/transmission-telegram-bot/transmission"
+	"github.com/hekmon/cunits/v2"
 )
 
 func main() {
@@ -28,16 +31,58 @@ func main() {
 
 	// Initialize the Telegram bot
 	log.Println("Initialize Telegram Bot")
-	telegramBot, err := bot.NewBot(cfg.Telegram.BotToken)
+	telegramBot, err := bot.NewBot(cfg)
 	if err != nil {
 		log.Fatal("Error initializing Telegram bot:", err)
 	}
 
+	// Initialize the download watcher, subscribing the bot before the first poll so
+	// downloads finished while we were down are reported
+	log.Println("Launch download watcher")
+	downloadStore := transmission.NewStore("config/downloads.gob")
+	watcher := transmission.NewWatcher(transmissionClient, downloadStore, time.Minute,
+		time.Duration(cfg.Watcher.StallMinutes)*time.Minute)
+	watcher.Subscribe(telegramBot.HandleWatcherEvent)
+	watcher.Subscribe(func(event transmission.Event) {
+		telegramBot.HandleTorrentMetadata(transmissionClient, event)
+	})
+	if cfg.Telegram.Announce.Enabled {
+		watcher.EnableAnnouncements()
+	}
+	go watcher.Run()
+
+	// Initialize the seeding policies, which also remove the torrents done seeding
+	log.Println("Launch seeding policies")
+	seeder := transmission.NewSeeder(transmissionClient, cfg.Seeding, cfg.Downloads.Presets,
+		"config/seeding_applied.gob", 5*time.Minute)
+	seeder.Subscribe(telegramBot.HandleSeedingRemovals)
+	watcher.Subscribe(seeder.HandleWatcherEvent)
+	go seeder.Run()
+
+	// Initialize the disk space guard, which pauses the downloads when a disk runs low
+	if cfg.DiskGuard.MinFreeGB > 0 {
+		log.Println("Launch disk space guard")
+		guard := transmission.NewDiskGuard(transmissionClient, cfg.DiskGuard.Dirs,
+			cunits.ImportInGiB(cfg.DiskGuard.MinFreeGB), time.Duration(cfg.DiskGuard.CheckMinutes)*time.Minute)
+		guard.Subscribe(telegramBot.HandleDiskAlert)
+		go guard.Run()
+	}
+
+	// Initialize the RSS poller, which replaces the transmission-rss container when enabled
+	if cfg.RSS.Poll {
+		log.Println("Launch RSS poller")
+		poller := feeds.NewPoller(transmissionClient, feeds.NewStore("config/rss_seen.gob"),
+			cfg.DiskGuard, time.Duration(cfg.RSS.IntervalMinutes)*time.Minute)
+		poller.Subscribe(telegramBot.HandleFeedAdditions)
+		telegramBot.SetFeedPoller(poller, watcher)
+		go poller.Run()
+	}
+
 	// Initialize solarman alerts daemon
 	log.Println("Launch Solarman alert daemon")
 	go solarman.ApiAlert(cfg)
 
 	// Handle incoming messages and commands for the bot
-	telegramBot.Start(transmissionClient)
+	telegramBot.Start(transmissionClient, watcher)
 
 }
@@ -0,0 +1,137 @@
+package metainfo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxDepth limits the nesting of bencoded values so a crafted file cannot exhaust the stack
+const maxDepth = 64
+
+var errUnexpectedEnd = errors.New("unexpected end of data")
+
+// decoder reads bencoded values, it remembers where the top level "info" dictionary
+// starts and ends so its hash can be computed over the original bytes
+type decoder struct {
+	data      []byte
+	pos       int
+	infoStart int
+	infoEnd   int
+}
+
+// decode parses a single bencoded value and checks nothing follows it
+func decode(data []byte) (interface{}, []byte, error) {
+	d := &decoder{data: data, infoStart: -1}
+
+	value, err := d.value(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, nil, fmt.Errorf("trailing data at offset %d", d.pos)
+	}
+
+	var info []byte
+	if d.infoStart >= 0 {
+		info = data[d.infoStart:d.infoEnd]
+	}
+	return value, info, nil
+}
+
+// value parses the value starting at the current position, which can be an int64,
+// a string, a []interface{} or a map[string]interface{}
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("values nested too deep")
+	}
+	if d.pos >= len(d.data) {
+		return nil, errUnexpectedEnd
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		d.pos++
+		return d.integer('e')
+	case c == 'l':
+		d.pos++
+		var list []interface{}
+		for {
+			if d.pos >= len(d.data) {
+				return nil, errUnexpectedEnd
+			}
+			if d.data[d.pos] == 'e' {
+				d.pos++
+				return list, nil
+			}
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+	case c == 'd':
+		d.pos++
+		dict := make(map[string]interface{})
+		for {
+			if d.pos >= len(d.data) {
+				return nil, errUnexpectedEnd
+			}
+			if d.data[d.pos] == 'e' {
+				d.pos++
+				return dict, nil
+			}
+			key, err := d.string()
+			if err != nil {
+				return nil, fmt.Errorf("invalid dictionary key: %v", err)
+			}
+
+			start := d.pos
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if depth == 0 && key == "info" {
+				d.infoStart, d.infoEnd = start, d.pos
+			}
+			dict[key] = item
+		}
+	case c >= '0' && c <= '9':
+		return d.string()
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, d.pos)
+	}
+}
+
+// integer reads digits up to the terminator
+func (d *decoder) integer(terminator byte) (int64, error) {
+	start := d.pos
+	for d.pos < len(d.data) && d.data[d.pos] != terminator {
+		d.pos++
+	}
+	if d.pos >= len(d.data) {
+		return 0, errUnexpectedEnd
+	}
+
+	n, err := strconv.ParseInt(string(d.data[start:d.pos]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer at offset %d", start)
+	}
+	d.pos++
+	return n, nil
+}
+
+// string reads a <length>:<bytes> string
+func (d *decoder) string() (string, error) {
+	length, err := d.integer(':')
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || length > int64(len(d.data)-d.pos) {
+		return "", errUnexpectedEnd
+	}
+
+	s := string(d.data[d.pos : d.pos+int(length)])
+	d.pos += int(length)
+	return s, nil
+}
@@ -0,0 +1,244 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxFileSize is the largest .torrent file accepted, real ones are rarely over a few megabytes
+const maxFileSize = 10 << 20
+
+// Metainfo summarizes a torrent file or a magnet link before it is handed to Transmission
+type Metainfo struct {
+	Name       string
+	TotalSize  int64 // 0 when unknown, as for most magnet links
+	Files      int   // 0 when unknown, as for magnet links
+	InfoHash   string
+	InfoHashV2 string
+	Magnet     bool
+}
+
+// Hash returns the info-hash Transmission reports for the torrent: the v1 hash, or the
+// truncated v2 hash for v2-only torrents
+func (m *Metainfo) Hash() string {
+	if m.InfoHash != "" {
+		return m.InfoHash
+	}
+	if len(m.InfoHashV2) >= 40 {
+		return m.InfoHashV2[:40]
+	}
+	return ""
+}
+
+// ParseFile reads and validates a .torrent file
+func ParseFile(path string) (*Metainfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() > maxFileSize {
+		return nil, fmt.Errorf("file too big for a torrent (%d bytes)", stat.Size())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse validates the content of a .torrent file and summarizes it
+func Parse(data []byte) (*Metainfo, error) {
+	value, rawInfo, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("not a torrent file: %v", err)
+	}
+
+	root, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("not a torrent file: not a dictionary")
+	}
+	info, ok := root["info"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("not a torrent file: missing info dictionary")
+	}
+
+	m := &Metainfo{}
+	if m.Name, ok = info["name"].(string); !ok || m.Name == "" {
+		return nil, errors.New("invalid torrent: missing name")
+	}
+
+	_, v1 := info["pieces"].(string)
+	version, _ := info["meta version"].(int64)
+	v2 := version == 2
+
+	switch {
+	case v1:
+		if err := m.countV1Files(info); err != nil {
+			return nil, err
+		}
+	case v2:
+		tree, ok := info["file tree"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("invalid torrent: missing file tree")
+		}
+		if err := m.countV2Files(tree, 0); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("invalid torrent: no pieces")
+	}
+
+	if m.Files == 0 {
+		return nil, errors.New("invalid torrent: no files")
+	}
+
+	if v1 {
+		sum := sha1.Sum(rawInfo)
+		m.InfoHash = hex.EncodeToString(sum[:])
+	}
+	if v2 {
+		sum := sha256.Sum256(rawInfo)
+		m.InfoHashV2 = hex.EncodeToString(sum[:])
+	}
+
+	return m, nil
+}
+
+// countV1Files adds up the files of a v1 info dictionary, skipping padding files
+func (m *Metainfo) countV1Files(info map[string]interface{}) error {
+	if length, ok := info["length"].(int64); ok {
+		m.Files = 1
+		m.TotalSize = length
+		return nil
+	}
+
+	files, ok := info["files"].([]interface{})
+	if !ok {
+		return errors.New("invalid torrent: missing length and files")
+	}
+	for _, f := range files {
+		file, ok := f.(map[string]interface{})
+		if !ok {
+			return errors.New("invalid torrent: malformed file entry")
+		}
+		length, ok := file["length"].(int64)
+		if !ok || length < 0 {
+			return errors.New("invalid torrent: file without length")
+		}
+		if attr, _ := file["attr"].(string); strings.Contains(attr, "p") {
+			continue
+		}
+		m.Files++
+		m.TotalSize += length
+	}
+	return nil
+}
+
+// countV2Files walks a v2 file tree, files are the nodes with an empty key
+func (m *Metainfo) countV2Files(tree map[string]interface{}, depth int) error {
+	if depth > maxDepth {
+		return errors.New("invalid torrent: file tree nested too deep")
+	}
+
+	for name, n := range tree {
+		node, ok := n.(map[string]interface{})
+		if !ok {
+			return errors.New("invalid torrent: malformed file tree")
+		}
+
+		if name == "" {
+			length, ok := node["length"].(int64)
+			if !ok || length < 0 {
+				return errors.New("invalid torrent: file without length")
+			}
+			m.Files++
+			m.TotalSize += length
+			continue
+		}
+
+		if err := m.countV2Files(node, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseMagnet validates a magnet link, it must carry a v1 (urn:btih) or v2 (urn:btmh) info-hash
+func ParseMagnet(link string) (*Metainfo, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Scheme != "magnet" {
+		return nil, errors.New("not a magnet link")
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid magnet link: %v", err)
+	}
+
+	m := &Metainfo{Magnet: true, Name: query.Get("dn")}
+	for _, xt := range query["xt"] {
+		switch {
+		case strings.HasPrefix(xt, "urn:btih:"):
+			if m.InfoHash, err = parseBTIH(strings.TrimPrefix(xt, "urn:btih:")); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(xt, "urn:btmh:"):
+			if m.InfoHashV2, err = parseBTMH(strings.TrimPrefix(xt, "urn:btmh:")); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if m.InfoHash == "" && m.InfoHashV2 == "" {
+		return nil, errors.New("invalid magnet link: no urn:btih or urn:btmh info-hash")
+	}
+
+	if xl := query.Get("xl"); xl != "" {
+		if size, err := strconv.ParseInt(xl, 10, 64); err == nil && size > 0 {
+			m.TotalSize = size
+		}
+	}
+
+	return m, nil
+}
+
+// parseBTIH decodes a v1 info-hash, given as 40 hex or 32 base32 characters, into lower case hex
+func parseBTIH(hash string) (string, error) {
+	switch len(hash) {
+	case 40:
+		if _, err := hex.DecodeString(hash); err != nil {
+			return "", fmt.Errorf("invalid magnet link: bad hex info-hash %q", hash)
+		}
+		return strings.ToLower(hash), nil
+	case 32:
+		raw, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash))
+		if err != nil {
+			return "", fmt.Errorf("invalid magnet link: bad base32 info-hash %q", hash)
+		}
+		return hex.EncodeToString(raw), nil
+	default:
+		return "", fmt.Errorf("invalid magnet link: info-hash %q has the wrong length", hash)
+	}
+}
+
+// parseBTMH decodes a v2 info-hash, a SHA-256 multihash (1220 followed by 64 hex characters)
+func parseBTMH(hash string) (string, error) {
+	hash = strings.ToLower(hash)
+	if len(hash) != 68 || !strings.HasPrefix(hash, "1220") {
+		return "", fmt.Errorf("invalid magnet link: unsupported multihash %q", hash)
+	}
+	if _, err := hex.DecodeString(hash[4:]); err != nil {
+		return "", fmt.Errorf("invalid magnet link: bad hex multihash %q", hash)
+	}
+	return hash[4:], nil
+}
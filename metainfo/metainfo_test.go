@@ -0,0 +1,196 @@
+package metainfo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	singleInfo = "d6:lengthi1024e4:name8:file.txt12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	// Holds a padding file, which is not counted
+	multiInfo = "d5:filesld6:lengthi100e4:pathl5:a.txteed4:attr1:p6:lengthi50e4:pathl4:.pad2:50eed6:lengthi200e4:pathl3:sub5:b.mkveee" +
+		"4:name4:Show12:piece lengthi16384e6:pieces20:bbbbbbbbbbbbbbbbbbbbe"
+	v2Info = "d9:file treed5:a.txtd0:d6:lengthi300e11:pieces root32:ccccccccccccccccccccccccccccccccee3:subd5:b.txtd0:d6:lengthi400eeeee" +
+		"12:meta versioni2e4:name2:V212:piece lengthi16384ee"
+)
+
+// torrent wraps an info dictionary into a .torrent file
+func torrent(info string) string {
+	announce := "http://tracker.example.com/announce"
+	return fmt.Sprintf("d8:announce%d:%s4:info%se", len(announce), announce, info)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Metainfo
+		hash string
+	}{
+		{
+			name: "single file",
+			data: torrent(singleInfo),
+			want: Metainfo{Name: "file.txt", TotalSize: 1024, Files: 1, InfoHash: "5e73478c8951a47213df390eedca1a9e580e47cb"},
+			hash: "5e73478c8951a47213df390eedca1a9e580e47cb",
+		},
+		{
+			name: "multiple files",
+			data: torrent(multiInfo),
+			want: Metainfo{Name: "Show", TotalSize: 300, Files: 2, InfoHash: "436b043762ff39113065d10ca96e8bccb134e9b4"},
+			hash: "436b043762ff39113065d10ca96e8bccb134e9b4",
+		},
+		{
+			name: "v2 only",
+			data: torrent(v2Info),
+			want: Metainfo{Name: "V2", TotalSize: 700, Files: 2,
+				InfoHashV2: "5581b50d0ff70adf85f422b9fd5f1c3f34f99278836dbe037bc536d0d23952e9"},
+			hash: "5581b50d0ff70adf85f422b9fd5f1c3f34f99278",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Parse([]byte(test.data))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if *m != test.want {
+				t.Errorf("got %+v, want %+v", *m, test.want)
+			}
+			if m.Hash() != test.hash {
+				t.Errorf("got hash %s, want %s", m.Hash(), test.hash)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	valid := torrent(singleInfo)
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", "", "unexpected end"},
+		{"truncated", valid[:len(valid)-1], "unexpected end"},
+		{"truncated string", valid[:len(valid)-30], "unexpected end"},
+		{"string longer than the data", "d4:info99999:abce", "unexpected end"},
+		{"trailing data", valid + "garbage", "trailing data"},
+		{"not a dictionary", "i42e", "not a dictionary"},
+		{"invalid integer", "d6:lengthi4x2ee", "invalid integer"},
+		{"missing info", "d8:announce3:abce", "missing info"},
+		{"missing name", torrent("d6:lengthi1e6:pieces20:aaaaaaaaaaaaaaaaaaaae"), "missing name"},
+		{"no pieces", torrent("d6:lengthi1e4:name1:ae"), "no pieces"},
+		{"no files", torrent("d5:filesle4:name1:a6:pieces20:aaaaaaaaaaaaaaaaaaaae"), "no files"},
+		{"nested too deep", strings.Repeat("l", maxDepth+2) + strings.Repeat("e", maxDepth+2), "nested too deep"},
+		{"file tree nested too deep", torrent("d9:file tree" + strings.Repeat("d1:a", maxDepth+2) + strings.Repeat("e", maxDepth+2) +
+			"12:meta versioni2e4:name1:ae"), "nested too deep"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte(test.data))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.torrent")
+	if err := os.WriteFile(valid, []byte(torrent(singleInfo)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := ParseFile(valid); err != nil || m.Name != "file.txt" {
+		t.Errorf("ParseFile = %+v, %v, want file.txt", m, err)
+	}
+
+	oversized := filepath.Join(dir, "oversized.torrent")
+	if err := os.WriteFile(oversized, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(oversized, maxFileSize+1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFile(oversized); err == nil || !strings.Contains(err.Error(), "too big") {
+		t.Errorf("got error %v, want the file to be too big", err)
+	}
+}
+
+func TestParseMagnet(t *testing.T) {
+	const btmh = "5581b50d0ff70adf85f422b9fd5f1c3f34f99278836dbe037bc536d0d23952e9"
+	tests := []struct {
+		name string
+		link string
+		want Metainfo
+	}{
+		{
+			name: "hex",
+			link: "magnet:?xt=urn:btih:5E73478C8951A47213DF390EEDCA1A9E580E47CB&dn=file.txt",
+			want: Metainfo{Name: "file.txt", InfoHash: "5e73478c8951a47213df390eedca1a9e580e47cb", Magnet: true},
+		},
+		{
+			name: "base32",
+			link: "magnet:?xt=urn:btih:LZZUPDEJKGSHEE67HEHO3SQ2TZMA4R6L",
+			want: Metainfo{InfoHash: "5e73478c8951a47213df390eedca1a9e580e47cb", Magnet: true},
+		},
+		{
+			name: "lower case base32 with size",
+			link: "magnet:?xt=urn:btih:lzzupdejkgshee67heho3sq2tzma4r6l&xl=1024",
+			want: Metainfo{TotalSize: 1024, InfoHash: "5e73478c8951a47213df390eedca1a9e580e47cb", Magnet: true},
+		},
+		{
+			name: "multihash",
+			link: "magnet:?xt=urn:btmh:1220" + btmh + "&dn=V2",
+			want: Metainfo{Name: "V2", InfoHashV2: btmh, Magnet: true},
+		},
+		{
+			name: "hybrid",
+			link: "magnet:?xt=urn:btih:5e73478c8951a47213df390eedca1a9e580e47cb&xt=urn:btmh:1220" + btmh,
+			want: Metainfo{InfoHash: "5e73478c8951a47213df390eedca1a9e580e47cb", InfoHashV2: btmh, Magnet: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := ParseMagnet(test.link)
+			if err != nil {
+				t.Fatalf("ParseMagnet: %v", err)
+			}
+			if *m != test.want {
+				t.Errorf("got %+v, want %+v", *m, test.want)
+			}
+		})
+	}
+}
+
+func TestParseMagnetInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{"not a magnet link", "http://example.com/file.torrent", "not a magnet link"},
+		{"no info-hash", "magnet:?dn=file.txt", "no urn:btih"},
+		{"bad hex", "magnet:?xt=urn:btih:zz73478c8951a47213df390eedca1a9e580e47cb", "bad hex"},
+		{"bad base32", "magnet:?xt=urn:btih:1ZZUPDEJKGSHEE67HEHO3SQ2TZMA4R6L", "bad base32"},
+		{"wrong length", "magnet:?xt=urn:btih:5e73478c", "wrong length"},
+		{"unsupported multihash", "magnet:?xt=urn:btmh:1114" + strings.Repeat("a", 64), "unsupported multihash"},
+		{"bad hex multihash", "magnet:?xt=urn:btmh:1220" + strings.Repeat("z", 64), "bad hex"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseMagnet(test.link)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
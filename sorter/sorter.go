@@ -0,0 +1,156 @@
+package sorter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+)
+
+// videoExtensions are the files worth sorting, anything else in a download is left alone
+var videoExtensions = map[string]bool{
+	".mkv": true, ".mp4": true, ".m4v": true, ".avi": true, ".mov": true, ".wmv": true, ".ts": true, ".webm": true,
+}
+
+var (
+	// episodePattern matches S02E05 or 2x05 and splits the title from the rest. The 2x05 form has
+	// to stand on its own so resolutions such as 1920x1080 or 1280x720 don't pass for episodes
+	episodePattern = regexp.MustCompile(`(?i)^(.*?)(?:[ ._-]*s(\d{1,2})[ ._-]?e(\d{1,3})|(?:^|[ ._(\[-]+)(\d{1,2})x(\d{2,3})(?:\D|$))`)
+	// moviePattern matches a title followed by a year, e.g. Movie.Title.2019.1080p
+	moviePattern = regexp.MustCompile(`^(.*?)[ ._(\[-]+((?:19|20)\d{2})(?:[ ._)\]-]|$)`)
+	// samplePattern matches the sample clips shipped with some releases
+	samplePattern = regexp.MustCompile(`(?i)(^|[ ._-])sample([ ._-]|$)`)
+)
+
+// Release is what a release name tells about its content
+type Release struct {
+	Title   string
+	Year    int
+	Season  int
+	Episode int
+	Movie   bool
+}
+
+// Parse reads a release name such as "Show.S02E05.1080p" or "Movie.2019.1080p"
+func Parse(name string) (Release, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+
+	if match := episodePattern.FindStringSubmatch(name); match != nil {
+		season, episode := match[2], match[3]
+		if season == "" {
+			season, episode = match[4], match[5]
+		}
+		release := Release{Title: cleanTitle(match[1])}
+		release.Season, _ = strconv.Atoi(season)
+		release.Episode, _ = strconv.Atoi(episode)
+		return release, release.Title != ""
+	}
+
+	if match := moviePattern.FindStringSubmatch(name); match != nil {
+		release := Release{Title: cleanTitle(match[1]), Movie: true}
+		release.Year, _ = strconv.Atoi(match[2])
+		return release, release.Title != ""
+	}
+
+	return Release{}, false
+}
+
+// cleanTitle turns the separators of a release name into spaces
+func cleanTitle(title string) string {
+	title = strings.NewReplacer(".", " ", "_", " ").Replace(title)
+	return strings.Trim(strings.Join(strings.Fields(title), " "), " -([")
+}
+
+// Path returns where a file of the release goes in a Plex-style library:
+// Show/Season 02/Show - S02E05.ext or Movie (2019)/Movie (2019).ext
+func (r Release) Path(library config.Library, ext string) string {
+	if r.Movie {
+		name := fmt.Sprintf("%s (%d)", r.Title, r.Year)
+		return filepath.Join(library.MoviesDir, name, name+ext)
+	}
+	return filepath.Join(library.TVDir, r.Title, fmt.Sprintf("Season %02d", r.Season),
+		fmt.Sprintf("%s - S%02dE%02d%s", r.Title, r.Season, r.Episode, ext))
+}
+
+// Move is a file to place in the library
+type Move struct {
+	Source string
+	Target string
+}
+
+// Plan decides where the videos of a download go. When the download has a single video, e.g. a
+// movie, a file name saying nothing falls back to the torrent name. The skipped videos are returned too
+func Plan(torrentName string, files []string, library config.Library) ([]Move, []string) {
+	var videos []string
+	for _, file := range files {
+		base := filepath.Base(file)
+		ext := filepath.Ext(base)
+		if videoExtensions[strings.ToLower(ext)] && !samplePattern.MatchString(strings.TrimSuffix(base, ext)) {
+			videos = append(videos, file)
+		}
+	}
+
+	var moves []Move
+	var skipped []string
+	for _, file := range videos {
+		release, ok := Parse(filepath.Base(file))
+		if !ok && len(videos) == 1 {
+			release, ok = Parse(torrentName)
+		}
+		if !ok || (release.Movie && library.MoviesDir == "") || (!release.Movie && library.TVDir == "") {
+			skipped = append(skipped, file)
+			continue
+		}
+
+		moves = append(moves, Move{Source: file, Target: release.Path(library, strings.ToLower(filepath.Ext(file)))})
+	}
+	return moves, skipped
+}
+
+// Apply places a file in the library, as a hard link unless the library asks for copies or
+// is on another filesystem. Existing files are never replaced
+func Apply(move Move, library config.Library) error {
+	if _, err := os.Stat(move.Target); err == nil {
+		return fmt.Errorf("%s already exists", move.Target)
+	}
+	if err := os.MkdirAll(filepath.Dir(move.Target), 0755); err != nil {
+		return err
+	}
+
+	if library.Mode != "copy" {
+		err := os.Link(move.Source, move.Target)
+		if err == nil || library.Mode == "hardlink" {
+			return err
+		}
+	}
+	return copyFile(move.Source, move.Target)
+}
+
+// copyFile copies a file, deleting the partial copy if anything goes wrong
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+		return fmt.Errorf("copy failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package torznab
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+)
+
+// maxResponseSize bounds what is read from an indexer or a torrent link
+const maxResponseSize = 10 << 20
+
+// Result is a torrent found by an indexer, Link is a magnet link or the URL of a .torrent file
+type Result struct {
+	Title    string
+	Link     string
+	Size     int64
+	Seeders  int
+	Peers    int
+	InfoHash string
+	Indexer  string
+}
+
+// feed is the part of a Torznab RSS response the bot uses
+type feed struct {
+	XMLName xml.Name
+	Items   []item `xml:"channel>item"`
+	// Set instead of the items when the indexer refuses the request
+	Code        string `xml:"code,attr"`
+	Description string `xml:"description,attr"`
+}
+
+type item struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	Size      int64  `xml:"size"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"enclosure"`
+	Attrs []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"`
+}
+
+// Search queries every indexer at once and returns their results sorted by seeders, along
+// with the errors of the indexers that failed
+func Search(indexers []config.Indexer, query string, timeout time.Duration) ([]Result, []error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var results []Result
+	var errs []error
+	for _, indexer := range indexers {
+		wg.Add(1)
+		go func(indexer config.Indexer) {
+			defer wg.Done()
+
+			found, err := searchIndexer(ctx, indexer, query)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", indexer.Name, err))
+				return
+			}
+			results = append(results, found...)
+		}(indexer)
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Seeders > results[j].Seeders
+	})
+	return results, errs
+}
+
+// searchIndexer runs a t=search request against a single indexer
+func searchIndexer(ctx context.Context, indexer config.Indexer, query string) ([]Result, error) {
+	endpoint, err := url.Parse(indexer.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+
+	params := endpoint.Query()
+	params.Set("t", "search")
+	params.Set("q", query)
+	if indexer.APIKey != "" {
+		params.Set("apikey", indexer.APIKey)
+	}
+	if len(indexer.Categories) > 0 {
+		categories := make([]string, len(indexer.Categories))
+		for i, category := range indexer.Categories {
+			categories[i] = strconv.Itoa(category)
+		}
+		params.Set("cat", strings.Join(categories, ","))
+	}
+	endpoint.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Keep the API key out of the error, it is part of the URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	return parse(io.LimitReader(resp.Body, maxResponseSize), indexer.Name)
+}
+
+// parse reads a Torznab response, items without a link are dropped
+func parse(r io.Reader, indexer string) ([]Result, error) {
+	var f feed
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	if f.XMLName.Local == "error" {
+		return nil, fmt.Errorf("indexer error %s: %s", f.Code, f.Description)
+	}
+
+	var results []Result
+	for _, it := range f.Items {
+		result := Result{Title: strings.TrimSpace(it.Title), Size: it.Size, Indexer: indexer}
+		if result.Size == 0 {
+			result.Size = it.Enclosure.Length
+		}
+
+		link := it.Enclosure.URL
+		if link == "" {
+			link = it.Link
+		}
+		for _, attr := range it.Attrs {
+			switch attr.Name {
+			case "seeders":
+				result.Seeders, _ = strconv.Atoi(attr.Value)
+			case "peers":
+				result.Peers, _ = strconv.Atoi(attr.Value)
+			case "infohash":
+				result.InfoHash = strings.ToLower(attr.Value)
+			case "magneturl":
+				// A magnet link saves fetching the torrent through the indexer
+				link = attr.Value
+			case "size":
+				if result.Size == 0 {
+					result.Size, _ = strconv.ParseInt(attr.Value, 10, 64)
+				}
+			}
+		}
+		if link == "" {
+			continue
+		}
+		result.Link = link
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Redact removes the API key from a link found by an indexer, Jackett and Prowlarr put it in
+// their download links, so the link can be logged
+func Redact(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme == "magnet" {
+		return link
+	}
+	params := u.Query()
+	if params.Get("apikey") == "" {
+		return link
+	}
+	params.Set("apikey", "REDACTED")
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// errMagnet stops following redirects when an indexer turns out to redirect to a magnet link
+var errMagnet = errors.New("redirected to a magnet link")
+
+// Fetch gets a torrent link found by an indexer. Indexers often redirect their download links to
+// a magnet link, which is returned instead of the .torrent file content in that case
+func Fetch(link string, timeout time.Duration) (magnet string, data []byte, err error) {
+	if strings.HasPrefix(link, "magnet:") {
+		return link, nil, nil
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme == "magnet" {
+				magnet = req.URL.String()
+				return errMagnet
+			}
+			if len(via) >= 10 {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}
+
+	resp, err := client.Get(link)
+	if magnet != "" {
+		return magnet, nil, nil
+	}
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", nil, err
+	}
+	return "", data, nil
+}
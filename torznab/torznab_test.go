@@ -0,0 +1,197 @@
+package torznab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+)
+
+const firstResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+  <channel>
+    <title>First</title>
+    <item>
+      <title> Show S01E01 1080p </title>
+      <link>http://indexer/dl/1?apikey=secret</link>
+      <size>1000</size>
+      <torznab:attr name="seeders" value="5"/>
+      <torznab:attr name="peers" value="8"/>
+      <torznab:attr name="infohash" value="ABCDEF"/>
+    </item>
+    <item>
+      <title>Show S01E02</title>
+      <enclosure url="http://indexer/dl/2" length="2000" type="application/x-bittorrent"/>
+      <torznab:attr name="seeders" value="50"/>
+      <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:2"/>
+    </item>
+    <item>
+      <title>No link</title>
+      <torznab:attr name="seeders" value="100"/>
+    </item>
+  </channel>
+</rss>`
+
+const secondResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+  <channel>
+    <item>
+      <title>Show S01E03</title>
+      <link>magnet:?xt=urn:btih:3</link>
+      <torznab:attr name="size" value="3000"/>
+      <torznab:attr name="seeders" value="20"/>
+    </item>
+  </channel>
+</rss>`
+
+const errorResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<error code="100" description="Incorrect user credentials"/>`
+
+// serve starts an indexer answering every request with the given response
+func serve(t *testing.T, response string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("t") != "search" || r.URL.Query().Get("q") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParse(t *testing.T) {
+	results, err := parse(strings.NewReader(firstResponse), "First")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2 as the item without a link is dropped", len(results))
+	}
+
+	first := results[0]
+	if first.Title != "Show S01E01 1080p" || first.Link != "http://indexer/dl/1?apikey=secret" || first.Size != 1000 ||
+		first.Seeders != 5 || first.Peers != 8 || first.InfoHash != "abcdef" || first.Indexer != "First" {
+		t.Errorf("unexpected first result %+v", first)
+	}
+
+	second := results[1]
+	if second.Link != "magnet:?xt=urn:btih:2" {
+		t.Errorf("got link %q, want the magnet link to be preferred", second.Link)
+	}
+	if second.Size != 2000 {
+		t.Errorf("got size %d, want the enclosure length", second.Size)
+	}
+}
+
+func TestParseIndexerError(t *testing.T) {
+	_, err := parse(strings.NewReader(errorResponse), "First")
+	if err == nil || !strings.Contains(err.Error(), "Incorrect user credentials") {
+		t.Fatalf("got error %v, want the indexer error", err)
+	}
+}
+
+func TestSearchMergesAndSorts(t *testing.T) {
+	first := serve(t, firstResponse)
+	second := serve(t, secondResponse)
+
+	indexers := []config.Indexer{
+		{Name: "First", URL: first.URL, APIKey: "secret"},
+		{Name: "Second", URL: second.URL, Categories: []int{5000, 5040}},
+	}
+	results, errs := Search(indexers, "show", 5*time.Second)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	var titles []string
+	for _, result := range results {
+		titles = append(titles, result.Title)
+	}
+	want := "Show S01E02,Show S01E03,Show S01E01 1080p"
+	if got := strings.Join(titles, ","); got != want {
+		t.Errorf("got %s, want %s sorted by seeders", got, want)
+	}
+	if results[1].Indexer != "Second" || results[1].Size != 3000 {
+		t.Errorf("unexpected result of the second indexer %+v", results[1])
+	}
+}
+
+func TestSearchIndexerFailing(t *testing.T) {
+	working := serve(t, secondResponse)
+	refusing := serve(t, errorResponse)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	indexers := []config.Indexer{
+		{Name: "Working", URL: working.URL},
+		{Name: "Refusing", URL: refusing.URL},
+		{Name: "Broken", URL: broken.URL},
+	}
+	results, errs := Search(indexers, "show", 5*time.Second)
+	if len(results) != 1 || results[0].Indexer != "Working" {
+		t.Errorf("got %+v, want the result of the working indexer", results)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("got errors %v, want one per failing indexer", errs)
+	}
+	for _, err := range errs {
+		if !strings.HasPrefix(err.Error(), "Refusing: ") && !strings.HasPrefix(err.Error(), "Broken: ") {
+			t.Errorf("error %q doesn't name its indexer", err)
+		}
+	}
+}
+
+func TestSearchTimeout(t *testing.T) {
+	working := serve(t, secondResponse)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	indexers := []config.Indexer{
+		{Name: "Working", URL: working.URL},
+		{Name: "Slow", URL: slow.URL + "?apikey=secret"},
+	}
+	start := time.Now()
+	results, errs := Search(indexers, "show", 200*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("search took %v, want it bounded by the timeout", elapsed)
+	}
+	if len(results) != 1 {
+		t.Errorf("got %d results, want the one of the working indexer", len(results))
+	}
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "Slow: ") {
+		t.Fatalf("got errors %v, want the slow indexer to time out", errs)
+	}
+	if strings.Contains(errs[0].Error(), "secret") {
+		t.Errorf("error %q leaks the API key", errs[0])
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"http://indexer/dl/1?apikey=secret&file=Show", "http://indexer/dl/1?apikey=REDACTED&file=Show"},
+		{"http://indexer/dl/1?file=Show", "http://indexer/dl/1?file=Show"},
+		{"magnet:?xt=urn:btih:1&apikey=secret", "magnet:?xt=urn:btih:1&apikey=secret"},
+	}
+	for _, test := range tests {
+		if got := Redact(test.link); got != test.want {
+			t.Errorf("Redact(%q) = %q, want %q", test.link, got, test.want)
+		}
+	}
+}
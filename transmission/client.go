@@ -1,10 +1,20 @@
 package transmission
 
 import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
 	"github.com/Coolknight/transmission-telegram-bot/config"
+	"github.com/hekmon/cunits/v2"
 	"github.com/hekmon/transmissionrpc"
 )
 
+// listFields are the torrent fields needed to render a torrent list
+var listFields = []string{"id", "name", "status", "percentDone", "rateDownload", "eta", "sizeWhenDone", "downloadDir",
+	"queuePosition", "bandwidthPriority"}
+
 // Client struct holds the Transmission client
 type Client struct {
 	Client *transmissionrpc.Client
@@ -25,45 +35,277 @@ func NewClient(config config.Transmission) (*Client, error) {
 	return &Client{Client: client}, nil
 }
 
-// StartDownload starts a download using the Transmission client
-func (c *Client) StartDownload(magnetLink, downloadPath string) (int64, error) {
-	response, err := c.Client.TorrentAddFileDownloadDir(magnetLink, downloadPath)
+// StartDownload starts a download of a magnet link, a torrent URL, which Transmission fetches
+// itself, or a local torrent file using the Transmission client. A paused download is added
+// without being started. It tells whether Transmission already had the torrent, in which case
+// the returned ID is the one of the existing torrent and nothing was added
+func (c *Client) StartDownload(magnetLink, downloadPath string, paused bool) (int64, bool, error) {
+	payload := &transmissionrpc.TorrentAddPayload{DownloadDir: &downloadPath, Paused: &paused}
+	if strings.HasPrefix(magnetLink, "magnet:") || strings.HasPrefix(magnetLink, "http://") || strings.HasPrefix(magnetLink, "https://") {
+		payload.Filename = &magnetLink
+	} else {
+		b64, err := transmissionrpc.File2Base64(magnetLink)
+		if err != nil {
+			return 0, false, err
+		}
+		payload.MetaInfo = &b64
+	}
+
+	// TorrentAdd answers a duplicate as if the torrent was added, and the hash of a torrent URL
+	// is only known once Transmission fetched it, so the torrents already there tell them apart
+	before, err := c.Client.TorrentGet([]string{"id"}, nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	response, err := c.Client.TorrentAdd(payload)
 	if err != nil {
-		return 0, err
+		return 0, false, err
 	}
 
 	// Extract and return the torrent ID
-	torrentID := response.ID // Assuming only one torrent is added
-	return *torrentID, nil
+	torrentID := *response.ID // Assuming only one torrent is added
+	for _, torrent := range before {
+		if torrent.ID != nil && *torrent.ID == torrentID {
+			return torrentID, true, nil
+		}
+	}
+	return torrentID, false, nil
 }
 
-// IsDownloadComplete checks if the specified torrent download is complete
-func (c *Client) IsDownloadComplete(torrentID int64) (bool, error) {
-	torrents, err := c.Client.TorrentGet([]string{"id", "percentDone"}, []int64{torrentID})
+// DefaultDownloadDir returns the download directory configured in the Transmission session
+func (c *Client) DefaultDownloadDir() (string, error) {
+	session, err := c.Client.SessionArgumentsGet()
 	if err != nil {
-		return false, err
+		return "", err
+	}
+
+	if session.DownloadDir == nil {
+		return "", fmt.Errorf("transmission did not report its download dir")
+	}
+
+	return *session.DownloadDir, nil
+}
+
+// ValidateDownloadDir checks a download directory is an existing absolute path inside one of the
+// allowed roots, or inside the session download dir when there are none. It returns the cleaned
+// path and the free space Transmission sees there
+func (c *Client) ValidateDownloadDir(downloadDir string, allowedRoots []string) (string, cunits.Bits, error) {
+	// Paths are the daemon's, which is not necessarily running on this machine
+	if !path.IsAbs(downloadDir) {
+		return "", 0, fmt.Errorf("%q is not an absolute path", downloadDir)
 	}
+	downloadDir = path.Clean(downloadDir)
 
-	// Assuming only one torrent is retrieved
-	if len(torrents) == 1 {
-		percentDone := torrents[0].PercentDone
-		if *percentDone == 1.0 {
-			return true, nil // Download is complete
+	roots := allowedRoots
+	if len(roots) == 0 {
+		defaultDir, err := c.DefaultDownloadDir()
+		if err != nil {
+			return "", 0, err
 		}
-		return false, nil // Download is still in progress
+		roots = []string{defaultDir}
+	}
+
+	if !InDownloadDirs(downloadDir, roots) {
+		return "", 0, fmt.Errorf("%q is not inside %s", downloadDir, strings.Join(roots, ", "))
+	}
+
+	// Transmission can only tell the free space of existing directories, which also catches typos
+	freeSpace, err := c.Client.FreeSpace(downloadDir)
+	if err != nil {
+		return "", 0, fmt.Errorf("%q cannot be used: %v", downloadDir, err)
 	}
 
-	return false, nil // Handle the case when no torrents or multiple torrents are returned
+	return downloadDir, freeSpace, nil
 }
 
-// GetName returns the name of the specified torrent
-func (c *Client) GetName(torrentID int64) (string, error) {
-	torrents, err := c.Client.TorrentGet([]string{"id", "name"}, []int64{torrentID})
+// InDownloadDirs checks the directory is one of the given ones or inside them, an empty list matches everything
+func InDownloadDirs(downloadDir string, dirs []string) bool {
+	if len(dirs) == 0 {
+		return true
+	}
+
+	downloadDir = path.Clean(downloadDir)
+	for _, dir := range dirs {
+		dir = path.Clean(dir)
+		if downloadDir == dir || strings.HasPrefix(downloadDir, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// FreeSpace returns the free space Transmission sees in a directory
+func (c *Client) FreeSpace(dir string) (cunits.Bits, error) {
+	return c.Client.FreeSpace(dir)
+}
+
+// GetTorrent returns the list fields of a single torrent
+func (c *Client) GetTorrent(torrentID int64) (*transmissionrpc.Torrent, error) {
+	torrents, err := c.Client.TorrentGet(listFields, []int64{torrentID})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if len(torrents) != 1 {
+		return nil, fmt.Errorf("torrent %d not found", torrentID)
+	}
+
+	return torrents[0], nil
+}
+
+// detailFields are the torrent fields needed to summarize a finished download
+var detailFields = []string{"id", "name", "hashString", "status", "percentDone", "sizeWhenDone", "addedDate", "doneDate",
+	"uploadRatio", "downloadDir", "files", "fileStats"}
+
+// GetTorrentDetails returns a single torrent with the fields summarizing its download, files included
+func (c *Client) GetTorrentDetails(torrentID int64) (*transmissionrpc.Torrent, error) {
+	torrents, err := c.Client.TorrentGet(detailFields, []int64{torrentID})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(torrents) != 1 {
+		return nil, fmt.Errorf("torrent %d not found", torrentID)
+	}
+
+	return torrents[0], nil
+}
+
+// FindTorrent looks a torrent up by info-hash, it returns nil when Transmission doesn't have it
+func (c *Client) FindTorrent(hash string) (*transmissionrpc.Torrent, error) {
+	torrents, err := c.Client.TorrentGetHashes(listFields, []string{hash})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(torrents) == 0 {
+		return nil, nil
 	}
 
-	name := torrents[0].Name
+	return torrents[0], nil
+}
+
+// RelocateTorrent points a torrent to another directory holding its data, nothing is moved
+func (c *Client) RelocateTorrent(torrentID int64, location string) error {
+	return c.Client.TorrentSetLocation(torrentID, location, false)
+}
+
+// StartTorrents resumes the specified torrents
+func (c *Client) StartTorrents(torrentIDs []int64) error {
+	return c.Client.TorrentStartIDs(torrentIDs)
+}
+
+// StopTorrents pauses the specified torrents
+func (c *Client) StopTorrents(torrentIDs []int64) error {
+	return c.Client.TorrentStopIDs(torrentIDs)
+}
+
+// RemoveTorrents removes the specified torrents from Transmission, deleting the downloaded data if asked to
+func (c *Client) RemoveTorrents(torrentIDs []int64, deleteData bool) error {
+	return c.Client.TorrentRemove(&transmissionrpc.TorrentRemovePayload{
+		IDs:             torrentIDs,
+		DeleteLocalData: deleteData,
+	})
+}
+
+// VerifyTorrents queues the specified torrents for a hash check of their local data
+func (c *Client) VerifyTorrents(torrentIDs []int64) error {
+	return c.Client.TorrentVerifyIDs(torrentIDs)
+}
+
+// ReannounceTorrents asks the trackers of the specified torrents for more peers
+func (c *Client) ReannounceTorrents(torrentIDs []int64) error {
+	return c.Client.TorrentReannounceIDs(torrentIDs)
+}
+
+// MoveToQueueTop moves the specified torrents to the top of the queue
+func (c *Client) MoveToQueueTop(torrentIDs []int64) error {
+	return c.Client.QueueMoveTop(torrentIDs)
+}
+
+// MoveUpInQueue moves the specified torrents one position up in the queue
+func (c *Client) MoveUpInQueue(torrentIDs []int64) error {
+	return c.Client.QueueMoveUp(torrentIDs)
+}
+
+// MoveDownInQueue moves the specified torrents one position down in the queue
+func (c *Client) MoveDownInQueue(torrentIDs []int64) error {
+	return c.Client.QueueMoveDown(torrentIDs)
+}
+
+// MoveToQueueBottom moves the specified torrents to the bottom of the queue
+func (c *Client) MoveToQueueBottom(torrentIDs []int64) error {
+	return c.Client.QueueMoveBottom(torrentIDs)
+}
+
+// SetBandwidthPriority sets the bandwidth priority of the specified torrents, one of the
+// PriorityLow, PriorityNormal and PriorityHigh values also used for files
+func (c *Client) SetBandwidthPriority(torrentIDs []int64, priority int64) error {
+	return c.Client.TorrentSet(&transmissionrpc.TorrentSetPayload{
+		IDs:               torrentIDs,
+		BandwidthPriority: &priority,
+	})
+}
+
+// ListQueue returns the torrents downloading or waiting to download, in queue order
+func (c *Client) ListQueue() ([]*transmissionrpc.Torrent, error) {
+	torrents, err := c.ListTorrents("downloading")
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(torrents, func(i, j int) bool {
+		if torrents[i].QueuePosition == nil || torrents[j].QueuePosition == nil {
+			return torrents[j].QueuePosition == nil
+		}
+		return *torrents[i].QueuePosition < *torrents[j].QueuePosition
+	})
+
+	return torrents, nil
+}
+
+// ListTorrents returns the torrents matching the filter sorted by ID. The filter can be empty or "all",
+// "downloading", "seeding", "stopped" or "checking"
+func (c *Client) ListTorrents(filter string) ([]*transmissionrpc.Torrent, error) {
+	match, ok := statusFilters[filter]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter %q", filter)
+	}
+
+	torrents, err := c.Client.TorrentGet(listFields, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []*transmissionrpc.Torrent
+	for _, torrent := range torrents {
+		if torrent.Status != nil && match(*torrent.Status) {
+			filtered = append(filtered, torrent)
+		}
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		return *filtered[i].ID < *filtered[j].ID
+	})
+
+	return filtered, nil
+}
 
-	return *name, nil // Handle the case when no torrents or multiple torrents are returned
+// statusFilters maps the ListTorrents filters to the statuses they accept
+var statusFilters = map[string]func(transmissionrpc.TorrentStatus) bool{
+	"":    func(transmissionrpc.TorrentStatus) bool { return true },
+	"all": func(transmissionrpc.TorrentStatus) bool { return true },
+	"downloading": func(status transmissionrpc.TorrentStatus) bool {
+		return status == transmissionrpc.TorrentStatusDownload || status == transmissionrpc.TorrentStatusDownloadWait
+	},
+	"seeding": func(status transmissionrpc.TorrentStatus) bool {
+		return status == transmissionrpc.TorrentStatusSeed || status == transmissionrpc.TorrentStatusSeedWait
+	},
+	"stopped": func(status transmissionrpc.TorrentStatus) bool {
+		return status == transmissionrpc.TorrentStatusStopped
+	},
+	"checking": func(status transmissionrpc.TorrentStatus) bool {
+		return status == transmissionrpc.TorrentStatusCheck || status == transmissionrpc.TorrentStatusCheckWait
+	},
 }
@@ -0,0 +1,118 @@
+package transmission
+
+import (
+	"log"
+	"time"
+
+	"github.com/hekmon/cunits/v2"
+)
+
+// DiskAlert tells a download directory ran low on free space, or has enough again when Recovered
+// is set. Paused holds the downloads stopped because of it
+type DiskAlert struct {
+	Dir       string
+	Free      cunits.Bits
+	Paused    []int64
+	Recovered bool
+}
+
+// DiskGuard checks the free space of the download directories and pauses every download when
+// one of them drops below the threshold, so a full disk doesn't break everything else on it
+type DiskGuard struct {
+	client      *Client
+	dirs        []string
+	minFree     cunits.Bits
+	interval    time.Duration
+	low         map[string]bool
+	subscribers []func(DiskAlert)
+}
+
+// NewDiskGuard creates a guard checking the directories every interval, the session download
+// dir is checked when there are none
+func NewDiskGuard(client *Client, dirs []string, minFree cunits.Bits, interval time.Duration) *DiskGuard {
+	return &DiskGuard{
+		client:   client,
+		dirs:     dirs,
+		minFree:  minFree,
+		interval: interval,
+		low:      make(map[string]bool),
+	}
+}
+
+// Subscribe registers a handler called for every alert, it must be called before Run
+func (g *DiskGuard) Subscribe(handler func(DiskAlert)) {
+	g.subscribers = append(g.subscribers, handler)
+}
+
+// Run checks the free space until the program ends, it is designed to be launched as a goroutine
+func (g *DiskGuard) Run() {
+	if len(g.dirs) == 0 {
+		dir, err := g.client.DefaultDownloadDir()
+		if err != nil {
+			log.Printf("Error getting the download dir, free space won't be checked: %v", err)
+			return
+		}
+		g.dirs = []string{dir}
+	}
+
+	for {
+		for _, dir := range g.dirs {
+			if err := g.check(dir); err != nil {
+				log.Printf("Error checking free space of %s: %v", dir, err)
+			}
+		}
+		time.Sleep(g.interval)
+	}
+}
+
+// check pauses the downloads on every check while a directory is low, so the ones resumed or
+// added meanwhile are stopped too. It alerts once when the directory runs low, and once more when
+// it has enough space again
+func (g *DiskGuard) check(dir string) error {
+	free, err := g.client.FreeSpace(dir)
+	if err != nil {
+		return err
+	}
+
+	if free >= g.minFree {
+		if g.low[dir] {
+			g.low[dir] = false
+			g.emit(DiskAlert{Dir: dir, Free: free, Recovered: true})
+		}
+		return nil
+	}
+
+	// Seeding only reads, so only the torrents still downloading are stopped
+	torrents, err := g.client.ListTorrents("downloading")
+	if err != nil {
+		return err
+	}
+	var paused []int64
+	for _, torrent := range torrents {
+		paused = append(paused, *torrent.ID)
+	}
+	if len(paused) > 0 {
+		if err := g.client.StopTorrents(paused); err != nil {
+			return err
+		}
+	}
+
+	if g.low[dir] {
+		if len(paused) > 0 {
+			log.Printf("Still only %s free in %s, paused %d more downloads", free.GetHumanSizeRepresentation(), dir, len(paused))
+		}
+		return nil
+	}
+
+	g.low[dir] = true
+	log.Printf("Only %s free in %s, paused %d downloads", free.GetHumanSizeRepresentation(), dir, len(paused))
+	g.emit(DiskAlert{Dir: dir, Free: free, Paused: paused})
+	return nil
+}
+
+// emit calls every subscriber with the alert
+func (g *DiskGuard) emit(alert DiskAlert) {
+	for _, handler := range g.subscribers {
+		handler(alert)
+	}
+}
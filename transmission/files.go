@@ -0,0 +1,226 @@
+package transmission
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/hekmon/transmissionrpc"
+	"gopkg.in/yaml.v2"
+)
+
+// File priorities as understood by Transmission
+const (
+	PriorityLow    int64 = -1
+	PriorityNormal int64 = 0
+	PriorityHigh   int64 = 1
+)
+
+// File is a file of a torrent along with its download settings
+type File struct {
+	Name           string
+	Length         int64
+	BytesCompleted int64
+	Wanted         bool
+	Priority       int64
+}
+
+// GetFiles returns the files of a torrent, which are unknown for magnet links until
+// their metadata has been downloaded
+func (c *Client) GetFiles(torrentID int64) ([]File, error) {
+	torrents, err := c.Client.TorrentGet([]string{"id", "files", "fileStats"}, []int64{torrentID})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(torrents) != 1 {
+		return nil, fmt.Errorf("torrent %d not found", torrentID)
+	}
+
+	torrent := torrents[0]
+	if len(torrent.Files) != len(torrent.FileStats) {
+		return nil, fmt.Errorf("torrent %d has %d files but %d file stats", torrentID, len(torrent.Files), len(torrent.FileStats))
+	}
+
+	files := make([]File, len(torrent.Files))
+	for i, file := range torrent.Files {
+		files[i] = File{
+			Name:           file.Name,
+			Length:         file.Length,
+			BytesCompleted: file.BytesCompleted,
+			Wanted:         torrent.FileStats[i].Wanted,
+			Priority:       torrent.FileStats[i].Priority,
+		}
+	}
+
+	return files, nil
+}
+
+// SetFilesWanted selects whether the files with the given indices are downloaded
+func (c *Client) SetFilesWanted(torrentID int64, indices []int64, wanted bool) error {
+	payload := &transmissionrpc.TorrentSetPayload{IDs: []int64{torrentID}}
+	if wanted {
+		payload.FilesWanted = indices
+	} else {
+		payload.FilesUnwanted = indices
+	}
+	return c.Client.TorrentSet(payload)
+}
+
+// SetFilesPriority sets the download priority of the files with the given indices
+func (c *Client) SetFilesPriority(torrentID int64, indices []int64, priority int64) error {
+	payload := &transmissionrpc.TorrentSetPayload{IDs: []int64{torrentID}}
+	switch priority {
+	case PriorityLow:
+		payload.PriorityLow = indices
+	case PriorityHigh:
+		payload.PriorityHigh = indices
+	default:
+		payload.PriorityNormal = indices
+	}
+	return c.Client.TorrentSet(payload)
+}
+
+// FileRule selects the files of new torrents whose base name matches a glob pattern
+type FileRule struct {
+	Pattern  string `yaml:"pattern"`
+	Wanted   bool   `yaml:"wanted"`
+	Priority int64  `yaml:"priority"`
+}
+
+// Matches checks the rule pattern against the base name of the file, ignoring case
+func (r FileRule) Matches(name string) bool {
+	matched, err := path.Match(strings.ToLower(r.Pattern), strings.ToLower(path.Base(name)))
+	return err == nil && matched
+}
+
+// ApplyFileRules applies the first matching rule to every file of a torrent and returns how
+// many files were affected
+func (c *Client) ApplyFileRules(torrentID int64, rules []FileRule) (int, error) {
+	if len(rules) == 0 {
+		return 0, nil
+	}
+
+	files, err := c.GetFiles(torrentID)
+	if err != nil {
+		return 0, err
+	}
+
+	wanted := make(map[bool][]int64)
+	priorities := make(map[int64][]int64)
+	matched := 0
+	for i, file := range files {
+		for _, rule := range rules {
+			if rule.Matches(file.Name) {
+				wanted[rule.Wanted] = append(wanted[rule.Wanted], int64(i))
+				priorities[rule.Priority] = append(priorities[rule.Priority], int64(i))
+				matched++
+				break
+			}
+		}
+	}
+
+	for value, indices := range wanted {
+		if err := c.SetFilesWanted(torrentID, indices, value); err != nil {
+			return 0, err
+		}
+	}
+	for priority, indices := range priorities {
+		if err := c.SetFilesPriority(torrentID, indices, priority); err != nil {
+			return 0, err
+		}
+	}
+
+	return matched, nil
+}
+
+// RulesFromFiles turns the current selection of a torrent into one rule per file extension, e.g.
+// "*.nfo" unwanted, only for the extensions whose files all share a non default setting
+func RulesFromFiles(files []File) []FileRule {
+	var order []string
+	groups := make(map[string][]File)
+	for _, file := range files {
+		ext := strings.ToLower(path.Ext(file.Name))
+		if ext == "" {
+			continue
+		}
+		if _, ok := groups[ext]; !ok {
+			order = append(order, ext)
+		}
+		groups[ext] = append(groups[ext], file)
+	}
+
+	var rules []FileRule
+	for _, ext := range order {
+		group := groups[ext]
+		uniform := true
+		for _, file := range group[1:] {
+			if file.Wanted != group[0].Wanted || file.Priority != group[0].Priority {
+				uniform = false
+				break
+			}
+		}
+		if !uniform || (group[0].Wanted && group[0].Priority == PriorityNormal) {
+			continue
+		}
+
+		rules = append(rules, FileRule{Pattern: "*" + ext, Wanted: group[0].Wanted, Priority: group[0].Priority})
+	}
+
+	return rules
+}
+
+// FileRules keeps the file rules of each download preset in a YAML file
+type FileRules struct {
+	path  string
+	mu    sync.Mutex
+	rules map[string][]FileRule
+}
+
+// LoadFileRules reads the rules from the YAML file, a missing file means there are none
+func LoadFileRules(path string) (*FileRules, error) {
+	r := &FileRules{path: path, rules: make(map[string][]FileRule)}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, fmt.Errorf("error reading file rules: %v", err)
+	}
+
+	if err := yaml.Unmarshal(content, &r.rules); err != nil {
+		return r, fmt.Errorf("error unmarshalling file rules: %v", err)
+	}
+
+	return r, nil
+}
+
+// Get returns the rules of a preset
+func (r *FileRules) Get(preset string) []FileRule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rules[preset]
+}
+
+// Set replaces the rules of a preset and saves them all
+func (r *FileRules) Set(preset string, rules []FileRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules[preset] = rules
+
+	content, err := yaml.Marshal(r.rules)
+	if err != nil {
+		return fmt.Errorf("error marshalling file rules: %v", err)
+	}
+
+	if err := os.WriteFile(r.path, content, 0644); err != nil {
+		return fmt.Errorf("error writing file rules: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package transmission
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Coolknight/transmission-telegram-bot/config"
+	"github.com/Coolknight/transmission-telegram-bot/gobfile"
+	"github.com/hekmon/transmissionrpc"
+)
+
+// seedFields are the torrent fields needed to match and enforce the seeding policies
+var seedFields = []string{"id", "name", "hashString", "percentDone", "uploadRatio", "activityDate", "isFinished", "downloadDir", "trackers"}
+
+// SeedingRemoval describes a torrent removed once it met its seeding policy
+type SeedingRemoval struct {
+	TorrentID   int64
+	Name        string
+	Policy      string
+	Ratio       float64
+	DeletedData bool
+}
+
+// Seeder applies the seeding policies to every torrent in Transmission and removes the ones
+// whose policy asks for it once they are done seeding. A policy is applied only once to each
+// torrent, so limits changed by hand afterwards are kept
+type Seeder struct {
+	client      *Client
+	policies    []config.SeedingPolicy
+	presets     []config.Preset
+	interval    time.Duration
+	path        string
+	mu          sync.Mutex
+	applied     map[string]bool
+	subscribers []func([]SeedingRemoval)
+}
+
+// NewSeeder creates a seeder checking the torrents every interval, the presets are needed to
+// match the policies given by preset name. The info-hashes of the torrents whose policy was
+// applied are kept in the given gob file, Transmission renumbers its torrents when restarted
+func NewSeeder(client *Client, seeding config.Seeding, presets []config.Preset, path string, interval time.Duration) *Seeder {
+	applied := make(map[string]bool)
+	if err := gobfile.Load(path, &applied); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error loading the torrents with a seeding policy, applying them again: %v", err)
+		applied = make(map[string]bool)
+	}
+
+	return &Seeder{
+		client:   client,
+		policies: seeding.Policies,
+		presets:  presets,
+		interval: interval,
+		path:     path,
+		applied:  applied,
+	}
+}
+
+// Subscribe registers a handler called with the torrents removed in each check, handlers run
+// on the seeder goroutine
+func (s *Seeder) Subscribe(handler func([]SeedingRemoval)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribers = append(s.subscribers, handler)
+}
+
+// HandleWatcherEvent applies the policy of a torrent as soon as the watcher sees it added, the
+// periodic check catches the ones added while the watcher doesn't follow them
+func (s *Seeder) HandleWatcherEvent(event Event) {
+	if event.Type != EventAdded || len(s.policies) == 0 {
+		return
+	}
+
+	torrents, err := s.client.Client.TorrentGet(seedFields, []int64{event.TorrentID})
+	if err != nil {
+		log.Printf("Error getting torrent %d to apply its seeding policy: %v", event.TorrentID, err)
+		return
+	}
+	if len(torrents) != 1 {
+		return
+	}
+	if policy, ok := s.match(torrents[0]); ok && s.apply(torrents[0], policy) {
+		s.save()
+	}
+}
+
+// Run checks the torrents until the program ends, it is designed to be launched as a goroutine
+func (s *Seeder) Run() {
+	if len(s.policies) == 0 {
+		return
+	}
+
+	for {
+		if err := s.check(); err != nil {
+			log.Printf("Error enforcing seeding policies: %v", err)
+		}
+		time.Sleep(s.interval)
+	}
+}
+
+// check applies the policy of the torrents seen for the first time and removes the finished ones
+func (s *Seeder) check() error {
+	torrents, err := s.client.Client.TorrentGet(seedFields, nil)
+	if err != nil {
+		return err
+	}
+
+	var removals []SeedingRemoval
+	present := make(map[string]bool)
+	changed := false
+	for _, torrent := range torrents {
+		if torrent.ID == nil || torrent.HashString == nil {
+			continue
+		}
+		present[*torrent.HashString] = true
+
+		policy, ok := s.match(torrent)
+		if !ok {
+			continue
+		}
+
+		if s.apply(torrent, policy) {
+			changed = true
+		}
+
+		if !policy.Remove || !seedingDone(torrent, policy) {
+			continue
+		}
+
+		if err := s.client.RemoveTorrents([]int64{*torrent.ID}, policy.DeleteData); err != nil {
+			log.Printf("Error removing torrent %d after seeding: %v", *torrent.ID, err)
+			continue
+		}
+		log.Printf("Torrent %d removed by seeding policy %s", *torrent.ID, policy.Name)
+
+		removal := SeedingRemoval{TorrentID: *torrent.ID, Policy: policy.Name, DeletedData: policy.DeleteData}
+		if torrent.Name != nil {
+			removal.Name = *torrent.Name
+		}
+		if torrent.UploadRatio != nil {
+			removal.Ratio = *torrent.UploadRatio
+		}
+		removals = append(removals, removal)
+		delete(present, *torrent.HashString)
+	}
+
+	// Forget the torrents that are gone so the map doesn't grow forever
+	s.mu.Lock()
+	for hash := range s.applied {
+		if !present[hash] {
+			delete(s.applied, hash)
+			changed = true
+		}
+	}
+	s.mu.Unlock()
+	if changed {
+		s.save()
+	}
+
+	if len(removals) > 0 {
+		s.mu.Lock()
+		subscribers := s.subscribers
+		s.mu.Unlock()
+
+		for _, handler := range subscribers {
+			handler(removals)
+		}
+	}
+
+	return nil
+}
+
+// apply sets the limits of the policy on a torrent unless they were already set once, it tells
+// whether they were set now
+func (s *Seeder) apply(torrent *transmissionrpc.Torrent, policy config.SeedingPolicy) bool {
+	if torrent.HashString == nil {
+		return false
+	}
+	s.mu.Lock()
+	done := s.applied[*torrent.HashString]
+	s.mu.Unlock()
+	if done {
+		return false
+	}
+
+	if err := s.client.SetSeedLimits(*torrent.ID, policy.Ratio, policy.IdleMinutes); err != nil {
+		log.Printf("Error applying seeding policy %s to torrent %d: %v", policy.Name, *torrent.ID, err)
+		return false
+	}
+	log.Printf("Seeding policy %s applied to torrent %d", policy.Name, *torrent.ID)
+
+	s.mu.Lock()
+	s.applied[*torrent.HashString] = true
+	s.mu.Unlock()
+	return true
+}
+
+// save persists the info-hashes of the torrents whose policy was applied
+func (s *Seeder) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := gobfile.Save(s.path, s.applied); err != nil {
+		log.Printf("Error saving the torrents with a seeding policy: %v", err)
+	}
+}
+
+// match returns the first policy whose trackers or presets include the torrent
+func (s *Seeder) match(torrent *transmissionrpc.Torrent) (config.SeedingPolicy, bool) {
+	var hosts []string
+	for _, tracker := range torrent.Trackers {
+		if u, err := url.Parse(tracker.Announce); err == nil {
+			hosts = append(hosts, strings.ToLower(u.Hostname()))
+		}
+	}
+
+	downloadDir := ""
+	if torrent.DownloadDir != nil {
+		downloadDir = path.Clean(*torrent.DownloadDir)
+	}
+
+	for _, policy := range s.policies {
+		for _, pattern := range policy.Trackers {
+			pattern = strings.ToLower(pattern)
+			for _, host := range hosts {
+				if host == pattern || strings.HasSuffix(host, "."+pattern) {
+					return policy, true
+				}
+			}
+		}
+		for _, name := range policy.Presets {
+			for _, preset := range s.presets {
+				if preset.Name == name && path.Clean(preset.Path) == downloadDir {
+					return policy, true
+				}
+			}
+		}
+	}
+
+	return config.SeedingPolicy{}, false
+}
+
+// seedingDone checks a complete torrent has reached the ratio or idle limit of its policy, or
+// that Transmission stopped seeding it because of its own limits
+func seedingDone(torrent *transmissionrpc.Torrent, policy config.SeedingPolicy) bool {
+	if torrent.PercentDone == nil || *torrent.PercentDone < 1.0 {
+		return false
+	}
+	if torrent.IsFinished != nil && *torrent.IsFinished {
+		return true
+	}
+	if policy.Ratio > 0 && torrent.UploadRatio != nil && *torrent.UploadRatio >= policy.Ratio {
+		return true
+	}
+	if policy.IdleMinutes > 0 && torrent.ActivityDate != nil &&
+		time.Since(*torrent.ActivityDate) >= time.Duration(policy.IdleMinutes)*time.Minute {
+		return true
+	}
+	return false
+}
+
+// SetSeedLimits sets the ratio and idle minutes after which a torrent stops seeding, zero
+// values leave the corresponding global limit of Transmission in place
+func (c *Client) SetSeedLimits(torrentID int64, ratio float64, idleMinutes int64) error {
+	payload := &transmissionrpc.TorrentSetPayload{IDs: []int64{torrentID}}
+	if ratio > 0 {
+		mode := transmissionrpc.SeedRatioModeCustom
+		payload.SeedRatioMode = &mode
+		payload.SeedRatioLimit = &ratio
+	}
+	if idleMinutes > 0 {
+		// transmissionrpc v1.1.0 sends the raw value of the duration instead of the minutes
+		// it claims to convert it to, so the minutes go in as a bare number
+		limit := time.Duration(idleMinutes)
+		mode := int64(1)
+		payload.SeedIdleMode = &mode
+		payload.SeedIdleLimit = &limit
+	}
+	if payload.SeedRatioMode == nil && payload.SeedIdleMode == nil {
+		return nil
+	}
+	return c.Client.TorrentSet(payload)
+}
@@ -0,0 +1,166 @@
+package transmission
+
+import (
+	"github.com/hekmon/transmissionrpc"
+)
+
+// Days of the alt-speed schedule as Transmission encodes them (tr_sched_day), they can be or'ed
+const (
+	Sunday    int64 = 1 << 0
+	Monday    int64 = 1 << 1
+	Tuesday   int64 = 1 << 2
+	Wednesday int64 = 1 << 3
+	Thursday  int64 = 1 << 4
+	Friday    int64 = 1 << 5
+	Saturday  int64 = 1 << 6
+	Weekdays        = Monday | Tuesday | Wednesday | Thursday | Friday
+	Weekend         = Saturday | Sunday
+	AllDays         = Weekdays | Weekend
+)
+
+// SpeedSettings holds the current transfer rates (B/s) and the session speed limits (KB/s)
+type SpeedSettings struct {
+	DownloadRate     int64
+	UploadRate       int64
+	DownloadLimit    int64
+	DownloadLimited  bool
+	UploadLimit      int64
+	UploadLimited    bool
+	AltDownloadLimit int64
+	AltUploadLimit   int64
+	AltEnabled       bool
+}
+
+// AltSpeedSchedule is the time window in which Transmission turns alt-speed (turtle) mode on,
+// Begin and End are minutes after midnight and Days a combination of the day constants
+type AltSpeedSchedule struct {
+	Enabled bool
+	Begin   int64
+	End     int64
+	Days    int64
+}
+
+// GetSpeedSettings returns the current rates along with the normal and alt-speed limits
+func (c *Client) GetSpeedSettings() (*SpeedSettings, error) {
+	session, err := c.Client.SessionArgumentsGet()
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := c.Client.SessionStats()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SpeedSettings{
+		DownloadRate:     stats.DownloadSpeed,
+		UploadRate:       stats.UploadSpeed,
+		DownloadLimit:    int64Value(session.SpeedLimitDown),
+		DownloadLimited:  boolValue(session.SpeedLimitDownEnabled),
+		UploadLimit:      int64Value(session.SpeedLimitUp),
+		UploadLimited:    boolValue(session.SpeedLimitUpEnabled),
+		AltDownloadLimit: int64Value(session.AltSpeedDown),
+		AltUploadLimit:   int64Value(session.AltSpeedUp),
+		AltEnabled:       boolValue(session.AltSpeedEnabled),
+	}, nil
+}
+
+// SetDownloadLimit sets the global download limit in KB/s, zero or less removes it
+func (c *Client) SetDownloadLimit(limit int64) error {
+	enabled := limit > 0
+	payload := &transmissionrpc.SessionArguments{SpeedLimitDownEnabled: &enabled}
+	if enabled {
+		payload.SpeedLimitDown = &limit
+	}
+	return c.Client.SessionArgumentsSet(payload)
+}
+
+// SetUploadLimit sets the global upload limit in KB/s, zero or less removes it
+func (c *Client) SetUploadLimit(limit int64) error {
+	enabled := limit > 0
+	payload := &transmissionrpc.SessionArguments{SpeedLimitUpEnabled: &enabled}
+	if enabled {
+		payload.SpeedLimitUp = &limit
+	}
+	return c.Client.SessionArgumentsSet(payload)
+}
+
+// SetAltSpeed turns alt-speed (turtle) mode on or off
+func (c *Client) SetAltSpeed(enabled bool) error {
+	return c.Client.SessionArgumentsSet(&transmissionrpc.SessionArguments{AltSpeedEnabled: &enabled})
+}
+
+// SetAltSpeedLimits sets the download and upload limits used in alt-speed mode, in KB/s
+func (c *Client) SetAltSpeedLimits(download, upload int64) error {
+	return c.Client.SessionArgumentsSet(&transmissionrpc.SessionArguments{
+		AltSpeedDown: &download,
+		AltSpeedUp:   &upload,
+	})
+}
+
+// GetAltSpeedSchedule returns the alt-speed time window
+func (c *Client) GetAltSpeedSchedule() (*AltSpeedSchedule, error) {
+	session, err := c.Client.SessionArgumentsGet()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AltSpeedSchedule{
+		Enabled: boolValue(session.AltSpeedTimeEnabled),
+		Begin:   int64Value(session.AltSpeedTimeBegin),
+		End:     int64Value(session.AltSpeedTimeEnd),
+		Days:    int64Value(session.AltSpeedTimeDay),
+	}, nil
+}
+
+// SetAltSpeedSchedule replaces the alt-speed time window, a disabled schedule keeps its times
+func (c *Client) SetAltSpeedSchedule(schedule AltSpeedSchedule) error {
+	payload := &transmissionrpc.SessionArguments{AltSpeedTimeEnabled: &schedule.Enabled}
+	if schedule.Enabled {
+		payload.AltSpeedTimeBegin = &schedule.Begin
+		payload.AltSpeedTimeEnd = &schedule.End
+		payload.AltSpeedTimeDay = &schedule.Days
+	}
+	return c.Client.SessionArgumentsSet(payload)
+}
+
+// GetDownloadQueueSize returns how many torrents Transmission downloads at once, zero when
+// the download queue is disabled
+func (c *Client) GetDownloadQueueSize() (int64, error) {
+	session, err := c.Client.SessionArgumentsGet()
+	if err != nil {
+		return 0, err
+	}
+
+	if !boolValue(session.DownloadQueueEnabled) {
+		return 0, nil
+	}
+	return int64Value(session.DownloadQueueSize), nil
+}
+
+// SetDownloadQueueSize sets how many torrents Transmission downloads at once, zero or less
+// disables the download queue
+func (c *Client) SetDownloadQueueSize(size int64) error {
+	enabled := size > 0
+	payload := &transmissionrpc.SessionArguments{DownloadQueueEnabled: &enabled}
+	if enabled {
+		payload.DownloadQueueSize = &size
+	}
+	return c.Client.SessionArgumentsSet(payload)
+}
+
+// int64Value dereferences an optional session value
+func int64Value(value *int64) int64 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// boolValue dereferences an optional session value
+func boolValue(value *bool) bool {
+	if value == nil {
+		return false
+	}
+	return *value
+}
@@ -0,0 +1,51 @@
+package transmission
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/Coolknight/transmission-telegram-bot/gobfile"
+)
+
+// TrackedDownload is the persisted form of a torrent followed by the watcher
+type TrackedDownload struct {
+	TorrentID        int64
+	ChatID           int64
+	AwaitingMetadata bool
+}
+
+// Store keeps the tracked downloads on disk so they survive restarts
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStore creates a store backed by the given gob file
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load reads the tracked downloads, a missing file means there are none
+func (s *Store) Load() ([]TrackedDownload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var downloads []TrackedDownload
+	err := gobfile.Load(s.path, &downloads)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return downloads, nil
+}
+
+// Save replaces the stored downloads
+func (s *Store) Save(downloads []TrackedDownload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return gobfile.Save(s.path, downloads)
+}
@@ -0,0 +1,382 @@
+package transmission
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hekmon/transmissionrpc"
+)
+
+// maxBackoff caps the delay between polls after consecutive RPC failures
+const maxBackoff = 10 * time.Minute
+
+// watchFields are the torrent fields needed to follow the progress of a download
+var watchFields = []string{"id", "name", "status", "percentDone", "rateDownload", "peersConnected", "activityDate",
+	"error", "errorString", "downloadDir", "metadataPercentComplete"}
+
+// Values of the torrent error field, tracker warnings are usually transient and not reported
+const (
+	errorTrackerWarning int64 = 1
+	errorTrackerError   int64 = 2
+	errorLocal          int64 = 3
+)
+
+// EventType identifies what happened to a tracked torrent
+type EventType int
+
+const (
+	// EventAdded is emitted when a torrent starts being tracked
+	EventAdded EventType = iota
+	// EventCompleted is emitted when a tracked torrent finishes downloading
+	EventCompleted
+	// EventStalled is emitted when a tracked torrent that should be downloading makes no
+	// progress for a while, e.g. stuck at 99% with dead peers
+	EventStalled
+	// EventErrored is emitted when Transmission reports a tracker or local error for a tracked torrent
+	EventErrored
+	// EventRemoved is emitted when a tracked torrent disappears from Transmission before completing
+	EventRemoved
+	// EventMetadata is emitted when Transmission gets the metadata of a tracked torrent awaiting it,
+	// such as one added by magnet link, so its files can be listed
+	EventMetadata
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdded:
+		return "added"
+	case EventCompleted:
+		return "completed"
+	case EventStalled:
+		return "stalled"
+	case EventErrored:
+		return "errored"
+	case EventRemoved:
+		return "removed"
+	case EventMetadata:
+		return "metadata"
+	default:
+		return "<unknown>"
+	}
+}
+
+// Event describes a change in a tracked torrent. Torrent holds the last known state,
+// it only has the ID set for EventAdded and the last polled fields for EventRemoved.
+// EventCompleted carries the fields of Client.GetTorrentDetails whenever they could be fetched.
+// StalledFor tells how long an EventStalled torrent has gone without progress.
+// When announcements are enabled, torrents added outside the bot produce EventAdded
+// and EventCompleted events with a zero ChatID
+type Event struct {
+	Type       EventType
+	TorrentID  int64
+	ChatID     int64
+	Torrent    *transmissionrpc.Torrent
+	StalledFor time.Duration
+}
+
+// trackedTorrent holds what the watcher knows about a torrent between polls
+type trackedTorrent struct {
+	chatID           int64
+	torrent          *transmissionrpc.Torrent
+	lastProgress     time.Time
+	stalled          bool
+	errored          bool
+	awaitingMetadata bool
+}
+
+// Watcher polls Transmission for the tracked torrents with a single batched request per tick
+// and emits an Event to its subscribers every time one of them changes state
+type Watcher struct {
+	client      *Client
+	store       *Store
+	interval    time.Duration
+	stallAfter  time.Duration
+	mu          sync.Mutex
+	tracked     map[int64]*trackedTorrent
+	subscribers []func(Event)
+	announce    bool
+	known       map[int64]bool
+}
+
+// NewWatcher creates a watcher polling every interval, torrents without progress for
+// stallAfter are reported as stalled. The tracked torrents are persisted to the store
+func NewWatcher(client *Client, store *Store, interval, stallAfter time.Duration) *Watcher {
+	return &Watcher{
+		client:     client,
+		store:      store,
+		interval:   interval,
+		stallAfter: stallAfter,
+		tracked:    make(map[int64]*trackedTorrent),
+	}
+}
+
+// Subscribe registers a handler called for every event, handlers run on the watcher goroutine
+func (w *Watcher) Subscribe(handler func(Event)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.subscribers = append(w.subscribers, handler)
+}
+
+// EnableAnnouncements makes the watcher poll every torrent in Transmission and report the
+// ones added or completed outside the bot, it must be called before Run
+func (w *Watcher) EnableAnnouncements() {
+	w.announce = true
+}
+
+// Watch starts tracking a torrent on behalf of a chat
+func (w *Watcher) Watch(torrentID, chatID int64) {
+	w.mu.Lock()
+	w.tracked[torrentID] = &trackedTorrent{chatID: chatID, lastProgress: time.Now()}
+	w.save()
+	w.mu.Unlock()
+
+	w.emit(Event{
+		Type:      EventAdded,
+		TorrentID: torrentID,
+		ChatID:    chatID,
+		Torrent:   &transmissionrpc.Torrent{ID: &torrentID},
+	})
+}
+
+// AwaitMetadata makes the watcher emit EventMetadata once Transmission has the metadata of a
+// tracked torrent, it must be called after Watch
+func (w *Watcher) AwaitMetadata(torrentID int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if tracked, ok := w.tracked[torrentID]; ok {
+		tracked.awaitingMetadata = true
+		w.save()
+	}
+}
+
+// Run polls Transmission until the program ends, it is designed to be launched as a goroutine.
+// The downloads tracked before the last restart are reloaded and checked straight away, so
+// anything that finished or vanished while the bot was down is reported
+func (w *Watcher) Run() {
+	if err := w.restore(); err != nil {
+		log.Printf("Error restoring tracked downloads: %v", err)
+	}
+
+	delay := time.Duration(0)
+	for {
+		time.Sleep(delay)
+
+		if err := w.poll(); err != nil {
+			// Back off on consecutive failures instead of giving up on the torrents,
+			// starting from the poll interval so an unreachable Transmission isn't hammered
+			delay *= 2
+			if delay < w.interval {
+				delay = w.interval
+			}
+			if delay > maxBackoff {
+				delay = maxBackoff
+			}
+			log.Printf("Error polling torrents, retrying in %s: %v", delay, err)
+			continue
+		}
+		delay = w.interval
+	}
+}
+
+// restore tracks again the downloads found in the store
+func (w *Watcher) restore() error {
+	downloads, err := w.store.Load()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	for _, download := range downloads {
+		w.tracked[download.TorrentID] = &trackedTorrent{chatID: download.ChatID, lastProgress: now,
+			awaitingMetadata: download.AwaitingMetadata}
+	}
+	log.Printf("Restored %d tracked downloads", len(downloads))
+
+	return nil
+}
+
+// save persists the tracked torrents, it must be called with the lock held
+func (w *Watcher) save() {
+	downloads := make([]TrackedDownload, 0, len(w.tracked))
+	for id, tracked := range w.tracked {
+		downloads = append(downloads, TrackedDownload{TorrentID: id, ChatID: tracked.chatID,
+			AwaitingMetadata: tracked.awaitingMetadata})
+	}
+
+	if err := w.store.Save(downloads); err != nil {
+		log.Printf("Error saving tracked downloads: %v", err)
+	}
+}
+
+// poll fetches every tracked torrent at once and emits the resulting events
+func (w *Watcher) poll() error {
+	w.mu.Lock()
+	ids := make([]int64, 0, len(w.tracked))
+	for id := range w.tracked {
+		ids = append(ids, id)
+	}
+	w.mu.Unlock()
+
+	var torrents []*transmissionrpc.Torrent
+	var err error
+	if w.announce {
+		torrents, err = w.client.Client.TorrentGet(watchFields, nil)
+	} else if len(ids) > 0 {
+		torrents, err = w.client.Client.TorrentGet(watchFields, ids)
+	}
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[int64]*transmissionrpc.Torrent, len(torrents))
+	for _, torrent := range torrents {
+		byID[*torrent.ID] = torrent
+	}
+
+	var events []Event
+	changed := false
+	now := time.Now()
+
+	w.mu.Lock()
+	for _, id := range ids {
+		tracked, ok := w.tracked[id]
+		if !ok {
+			continue
+		}
+
+		torrent, ok := byID[id]
+		if !ok {
+			delete(w.tracked, id)
+			changed = true
+			events = append(events, Event{Type: EventRemoved, TorrentID: id, ChatID: tracked.chatID, Torrent: tracked.torrent})
+			continue
+		}
+
+		awaiting := tracked.awaitingMetadata
+		events = append(events, w.update(id, tracked, torrent, now)...)
+		if _, ok := w.tracked[id]; !ok || tracked.awaitingMetadata != awaiting {
+			changed = true
+		}
+	}
+	if changed {
+		w.save()
+	}
+	if w.announce {
+		events = append(events, w.diff(torrents, ids)...)
+	}
+	w.mu.Unlock()
+
+	for _, event := range events {
+		if event.Type == EventCompleted {
+			// Finished downloads are summarized, which needs more than the polled fields
+			if details, err := w.client.GetTorrentDetails(event.TorrentID); err != nil {
+				log.Printf("Error getting details of completed torrent %d: %v", event.TorrentID, err)
+			} else {
+				event.Torrent = details
+			}
+		}
+		w.emit(event)
+	}
+	return nil
+}
+
+// update records the new state of a tracked torrent and returns the events it triggers,
+// it must be called with the lock held
+func (w *Watcher) update(id int64, tracked *trackedTorrent, torrent *transmissionrpc.Torrent, now time.Time) []Event {
+	var events []Event
+	event := func(t EventType) {
+		events = append(events, Event{Type: t, TorrentID: id, ChatID: tracked.chatID, Torrent: torrent})
+	}
+
+	previous := tracked.torrent
+	tracked.torrent = torrent
+
+	if tracked.awaitingMetadata && torrent.MetadataPercentComplete != nil && *torrent.MetadataPercentComplete == 1.0 {
+		tracked.awaitingMetadata = false
+		event(EventMetadata)
+	}
+
+	if torrent.PercentDone != nil && *torrent.PercentDone == 1.0 {
+		delete(w.tracked, id)
+		event(EventCompleted)
+		return events
+	}
+
+	hasError := torrent.Error != nil && (*torrent.Error == errorTrackerError || *torrent.Error == errorLocal)
+	if hasError && !tracked.errored {
+		event(EventErrored)
+	}
+	tracked.errored = hasError
+
+	switch {
+	case previous == nil:
+		// After a restart the last activity Transmission saw is a better guess than now
+		if torrent.ActivityDate != nil && torrent.ActivityDate.Unix() > 0 && torrent.ActivityDate.Before(now) {
+			tracked.lastProgress = *torrent.ActivityDate
+		}
+	case previous.PercentDone == nil || torrent.PercentDone == nil || *torrent.PercentDone > *previous.PercentDone:
+		tracked.lastProgress = now
+		tracked.stalled = false
+	}
+
+	// Only a torrent that is meant to be downloading can stall, not a queued or paused one
+	downloading := torrent.Status != nil && *torrent.Status == transmissionrpc.TorrentStatusDownload
+	if !downloading {
+		tracked.lastProgress = now
+		tracked.stalled = false
+	} else if !tracked.stalled && !hasError && now.Sub(tracked.lastProgress) >= w.stallAfter {
+		tracked.stalled = true
+		events = append(events, Event{Type: EventStalled, TorrentID: id, ChatID: tracked.chatID, Torrent: torrent,
+			StalledFor: now.Sub(tracked.lastProgress)})
+	}
+
+	return events
+}
+
+// diff compares the full torrent list with the previous one and returns the events for the
+// torrents the bot is not tracking, the first call only records the current state. The tracked
+// torrents are the ones polled, which may have completed since, and the ones tracked now, which
+// the bot may have added while the list was being fetched. It must be called with the lock held
+func (w *Watcher) diff(torrents []*transmissionrpc.Torrent, trackedIDs []int64) []Event {
+	tracked := make(map[int64]bool, len(trackedIDs))
+	for _, id := range trackedIDs {
+		tracked[id] = true
+	}
+
+	var events []Event
+	known := make(map[int64]bool, len(torrents))
+	for _, torrent := range torrents {
+		id := *torrent.ID
+		done := torrent.PercentDone != nil && *torrent.PercentDone == 1.0
+		known[id] = done
+
+		if w.known == nil || tracked[id] || w.tracked[id] != nil {
+			continue
+		}
+		if wasDone, seen := w.known[id]; !seen {
+			events = append(events, Event{Type: EventAdded, TorrentID: id, Torrent: torrent})
+		} else if done && !wasDone {
+			events = append(events, Event{Type: EventCompleted, TorrentID: id, Torrent: torrent})
+		}
+	}
+	w.known = known
+
+	return events
+}
+
+// emit calls every subscriber with the event
+func (w *Watcher) emit(event Event) {
+	w.mu.Lock()
+	subscribers := append([]func(Event){}, w.subscribers...)
+	w.mu.Unlock()
+
+	for _, handler := range subscribers {
+		handler(event)
+	}
+}
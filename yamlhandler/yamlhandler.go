@@ -1,21 +1,55 @@
 package yamlhandler
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
 
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Feeds  []Feed       `yaml:"feeds"`
-	Server ServerConfig `yaml:"server"`
-	Login  LoginConfig  `yaml:"login"`
+	Feeds []Feed `yaml:"feeds"`
+	// DisabledFeeds are kept out of feeds so transmission-rss doesn't read them
+	DisabledFeeds []Feed       `yaml:"disabled_feeds,omitempty"`
+	Server        ServerConfig `yaml:"server"`
+	Login         LoginConfig  `yaml:"login"`
+	// Extra keeps the other transmission-rss settings when the file is rewritten
+	Extra map[string]interface{} `yaml:",inline"`
 }
 
 type Feed struct {
 	URL          string `yaml:"url"`
 	DownloadPath string `yaml:"download_path"`
+	// Include and Exclude filter the item titles, Include keeps the transmission-rss name
+	Include Patterns `yaml:"regexp,omitempty"`
+	Exclude Patterns `yaml:"exclude,omitempty"`
+	// Extra keeps the other settings of the feed when the file is rewritten
+	Extra map[string]interface{} `yaml:",inline"`
+	// Enabled tells in which list the feed is stored
+	Enabled bool `yaml:"-"`
+}
+
+// Patterns are regular expressions, written either as a single string or as a list
+type Patterns []string
+
+// UnmarshalYAML accepts a single pattern as well as a list
+func (p *Patterns) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*p = Patterns{single}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return fmt.Errorf("regular expressions must be a string or a list of strings")
+	}
+	*p = list
+	return nil
 }
 
 type ServerConfig struct {
@@ -31,18 +65,16 @@ type LoginConfig struct {
 
 const filePath = "rss/rss.conf"
 
+// mu serializes the changes to the file, each one reads and rewrites it whole
+var mu sync.Mutex
+
 func AddFeedToYAML(url, downloadPath string) error {
-	// Read existing YAML content
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("error reading YAML file: %v", err)
-	}
+	mu.Lock()
+	defer mu.Unlock()
 
-	var config Config
-	// Unmarshal YAML content into Config struct
-	err = yaml.Unmarshal(content, &config)
+	config, err := readConfig()
 	if err != nil {
-		return fmt.Errorf("error unmarshalling YAML: %v", err)
+		return err
 	}
 
 	// Add new feed to Config
@@ -52,6 +84,141 @@ func AddFeedToYAML(url, downloadPath string) error {
 	}
 	config.Feeds = append(config.Feeds, newFeed)
 
+	return writeConfig(config)
+}
+
+// ListFeeds returns the enabled feeds followed by the disabled ones, the other functions take
+// the index of a feed in this list
+func ListFeeds() ([]Feed, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	config, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+	return feeds(config), nil
+}
+
+// RemoveFeed deletes a feed and returns it
+func RemoveFeed(index int) (Feed, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	config, err := readConfig()
+	if err != nil {
+		return Feed{}, err
+	}
+	feed, err := takeFeed(&config, index)
+	if err != nil {
+		return Feed{}, err
+	}
+	return feed, writeConfig(config)
+}
+
+// UpdateFeed replaces a feed, moving it to the other list when Enabled changes. It tells whether
+// anything changed, the file is left untouched otherwise
+func UpdateFeed(index int, feed Feed) (bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	config, err := readConfig()
+	if err != nil {
+		return false, err
+	}
+	all := feeds(config)
+	if index < 0 || index >= len(all) {
+		return false, fmt.Errorf("there is no feed %d", index+1)
+	}
+	if reflect.DeepEqual(all[index], feed) {
+		return false, nil
+	}
+
+	if all[index].Enabled == feed.Enabled {
+		// Stay in place
+		if index < len(config.Feeds) {
+			config.Feeds[index] = feed
+		} else {
+			config.DisabledFeeds[index-len(config.Feeds)] = feed
+		}
+	} else {
+		takeFeed(&config, index)
+		if feed.Enabled {
+			config.Feeds = append(config.Feeds, feed)
+		} else {
+			config.DisabledFeeds = append(config.DisabledFeeds, feed)
+		}
+	}
+	return true, writeConfig(config)
+}
+
+// SetFeedEnabled enables or disables a feed, it tells whether anything changed
+func SetFeedEnabled(index int, enabled bool) (bool, error) {
+	all, err := ListFeeds()
+	if err != nil {
+		return false, err
+	}
+	if index < 0 || index >= len(all) {
+		return false, fmt.Errorf("there is no feed %d", index+1)
+	}
+
+	feed := all[index]
+	feed.Enabled = enabled
+	return UpdateFeed(index, feed)
+}
+
+// feeds lists the feeds of both lists, setting their Enabled field
+func feeds(config Config) []Feed {
+	var all []Feed
+	for _, feed := range config.Feeds {
+		feed.Enabled = true
+		all = append(all, feed)
+	}
+	for _, feed := range config.DisabledFeeds {
+		feed.Enabled = false
+		all = append(all, feed)
+	}
+	return all
+}
+
+// takeFeed removes a feed from whichever list holds it
+func takeFeed(config *Config, index int) (Feed, error) {
+	all := feeds(*config)
+	if index < 0 || index >= len(all) {
+		return Feed{}, fmt.Errorf("there is no feed %d", index+1)
+	}
+	feed := all[index]
+
+	if index < len(config.Feeds) {
+		config.Feeds = append(config.Feeds[:index], config.Feeds[index+1:]...)
+	} else {
+		index -= len(config.Feeds)
+		config.DisabledFeeds = append(config.DisabledFeeds[:index], config.DisabledFeeds[index+1:]...)
+	}
+	return feed, nil
+}
+
+func readConfig() (Config, error) {
+	var config Config
+
+	// Read existing YAML content, there are no feeds yet without it
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("error reading YAML file: %v", err)
+	}
+
+	// Unmarshal YAML content into Config struct
+	err = yaml.Unmarshal(content, &config)
+	if err != nil {
+		return config, fmt.Errorf("error unmarshalling YAML: %v", err)
+	}
+	return config, nil
+}
+
+func writeConfig(config Config) error {
 	// Marshal updated Config back to YAML
 	updatedYAML, err := yaml.Marshal(&config)
 	if err != nil {
@@ -59,6 +226,9 @@ func AddFeedToYAML(url, downloadPath string) error {
 	}
 
 	// Write updated YAML content to file
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("error creating YAML file directory: %v", err)
+	}
 	err = os.WriteFile(filePath, updatedYAML, 0644)
 	if err != nil {
 		return fmt.Errorf("error writing YAML file: %v", err)
@@ -0,0 +1,169 @@
+package yamlhandler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+const rssConf = `feeds:
+  - url: http://example.com/feed1
+    download_path: /downloads/tv
+    regexp: The Expanse
+    seed_ratio_limit: 2
+  - url: http://example.com/feed2
+    download_path: /downloads/movies
+    exclude:
+      - CAM
+      - TS
+server:
+  host: transmission
+  port: 9091
+  rpc_path: /transmission/rpc
+login:
+  username: admin
+  password: secret
+update_interval: 600
+seen_file: /config/seen
+privileges:
+  user: nobody
+`
+
+// useConfig runs the test in a temporary directory holding rss/rss.conf
+func useConfig(t *testing.T, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "rss"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, filePath), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// readRaw reads the file back without going through Config
+func readRaw(t *testing.T) map[string]interface{} {
+	t.Helper()
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestUpdateFeedKeepsUnknownKeys(t *testing.T) {
+	useConfig(t, rssConf)
+
+	all, err := ListFeeds()
+	if err != nil {
+		t.Fatalf("ListFeeds: %v", err)
+	}
+	feed := all[0]
+	feed.DownloadPath = "/downloads/series"
+	changed, err := UpdateFeed(0, feed)
+	if err != nil || !changed {
+		t.Fatalf("UpdateFeed = %v, %v, want a change", changed, err)
+	}
+
+	raw := readRaw(t)
+	if raw["update_interval"] != 600 || raw["seen_file"] != "/config/seen" {
+		t.Errorf("global settings lost: %v", raw)
+	}
+	privileges, ok := raw["privileges"].(map[interface{}]interface{})
+	if !ok || privileges["user"] != "nobody" {
+		t.Errorf("nested global settings lost: %v", raw["privileges"])
+	}
+
+	feeds := raw["feeds"].([]interface{})
+	first := feeds[0].(map[interface{}]interface{})
+	if first["download_path"] != "/downloads/series" {
+		t.Errorf("got download_path %v, want the updated one", first["download_path"])
+	}
+	if first["regexp"] != "The Expanse" && !equalList(first["regexp"], "The Expanse") {
+		t.Errorf("got regexp %v, want it kept", first["regexp"])
+	}
+	if first["seed_ratio_limit"] != 2 {
+		t.Errorf("got seed_ratio_limit %v, want it kept", first["seed_ratio_limit"])
+	}
+	second := feeds[1].(map[interface{}]interface{})
+	if !equalList(second["exclude"], "CAM", "TS") {
+		t.Errorf("got exclude %v, want it kept", second["exclude"])
+	}
+}
+
+func TestDisabledFeedKeepsUnknownKeys(t *testing.T) {
+	useConfig(t, rssConf)
+
+	if _, err := SetFeedEnabled(0, false); err != nil {
+		t.Fatalf("SetFeedEnabled: %v", err)
+	}
+	raw := readRaw(t)
+	disabled, ok := raw["disabled_feeds"].([]interface{})
+	if !ok || len(disabled) != 1 {
+		t.Fatalf("got disabled_feeds %v, want the paused feed", raw["disabled_feeds"])
+	}
+	if feed := disabled[0].(map[interface{}]interface{}); feed["seed_ratio_limit"] != 2 {
+		t.Errorf("paused feed lost its settings: %v", feed)
+	}
+
+	if _, err := SetFeedEnabled(1, true); err != nil {
+		t.Fatalf("SetFeedEnabled: %v", err)
+	}
+	all, err := ListFeeds()
+	if err != nil {
+		t.Fatalf("ListFeeds: %v", err)
+	}
+	resumed := all[len(all)-1]
+	if !resumed.Enabled || resumed.Extra["seed_ratio_limit"] != 2 || len(resumed.Include) != 1 {
+		t.Errorf("resumed feed lost its settings: %+v", resumed)
+	}
+}
+
+func TestUpdateFeedUnchanged(t *testing.T) {
+	useConfig(t, rssConf)
+
+	all, err := ListFeeds()
+	if err != nil {
+		t.Fatalf("ListFeeds: %v", err)
+	}
+	changed, err := UpdateFeed(1, all[1])
+	if err != nil || changed {
+		t.Fatalf("UpdateFeed = %v, %v, want no change", changed, err)
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != rssConf {
+		t.Errorf("the file was rewritten:\n%s", content)
+	}
+}
+
+// equalList checks a YAML value is the list of the given strings
+func equalList(value interface{}, want ...string) bool {
+	list, ok := value.([]interface{})
+	if !ok || len(list) != len(want) {
+		return false
+	}
+	for i := range list {
+		if list[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}